@@ -0,0 +1,222 @@
+package api
+
+import (
+	"exchange/assets"
+	"exchange/assets/book"
+	"io"
+	"io/ioutil"
+
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Admin handlers control trading in an asset, rather than trading it.
+// TODO: Only allow these from admin api keys
+
+// auctionSchema defines the schema for starting a call auction over http
+type auctionSchema struct {
+	Duration int `json:"duration"` // Seconds until the uncross
+}
+
+// HandleStartAuction is the handler function for admin requests to start a call auction (opening, closing, etc.) on an
+// asset's book.  The book stops matching and uncrosses once duration is up
+func HandleStartAuction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+	if e != nil {
+		panic(e)
+	}
+
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	var auction auctionSchema
+	if err := json.Unmarshal(body, &auction); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	b := assets.GetBookByID(assetID)
+	if b == nil {
+		// ERROR: ASSET DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if b.GetState() == book.StateHalted {
+		// ERROR: HALTED ASSETS REOPEN THROUGH RESUME
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusConflict)
+		if err := json.NewEncoder(w).Encode("Asset is halted, resume it with a reopening auction instead"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if auction.Duration <= 0 {
+		// ERROR: INVALID DURATION
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Duration must be greater than 0"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// The book starts the auction between orders
+	b.StartAuction(time.Duration(auction.Duration) * time.Second)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(auction); err != nil {
+		panic(err)
+	}
+}
+
+// haltSchema defines the schema for halting an asset over http
+type haltSchema struct {
+	Note string `json:"note"` // Why trading is halted, e.g. news pending
+}
+
+// HandleHalt is the handler function for admin requests to halt trading in an asset.  Resting orders can be cancelled
+// while it's halted, but new orders are rejected
+func HandleHalt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+	if e != nil {
+		panic(e)
+	}
+
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	var halt haltSchema
+	if err := json.Unmarshal(body, &halt); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	b := assets.GetBookByID(assetID)
+	if b == nil {
+		// ERROR: ASSET DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// The book halts between orders
+	b.Halt(halt.Note)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(halt); err != nil {
+		panic(err)
+	}
+}
+
+// resumeSchema defines the schema for resuming trading in an asset over http
+type resumeSchema struct {
+	AuctionDuration int `json:"auction_duration"` // Seconds of reopening auction, 0 to go straight back to continuous trading
+}
+
+// HandleResume is the handler function for admin requests to resume trading in a halted asset, optionally through a
+// reopening auction
+func HandleResume(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+	if e != nil {
+		panic(e)
+	}
+
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	var resume resumeSchema
+	if err := json.Unmarshal(body, &resume); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	b := assets.GetBookByID(assetID)
+	if b == nil {
+		// ERROR: ASSET DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if b.GetState() != book.StateHalted {
+		// ERROR: NOTHING TO RESUME
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusConflict)
+		if err := json.NewEncoder(w).Encode("Asset isn't halted"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if resume.AuctionDuration < 0 {
+		// ERROR: INVALID DURATION
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Auction duration can't be negative"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// The book resumes between orders
+	b.Resume(time.Duration(resume.AuctionDuration) * time.Second)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(resume); err != nil {
+		panic(err)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -53,6 +55,124 @@ func HandleBookSnapshotRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// HandleRulesRequest is the handler function for the API requesting the instrument rules of an asset
+func HandleRulesRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+
+	if e != nil {
+		panic(e)
+	} else {
+		a := assets.GetAssetByID(assetID)
+		if a == nil {
+			// ERROR: ASSET DOESN'T EXIST
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+				panic(err)
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(a.GetRules())
+	}
+}
+
+// HandleStatusRequest is the handler function for the API requesting the trading status of an asset: whether it's
+// trading continuously or halted, why, and the price bands trades have to fall in
+func HandleStatusRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+
+	if e != nil {
+		panic(e)
+	} else {
+		b := assets.GetBookByID(assetID)
+		if b == nil {
+			// ERROR: ASSET DOESN'T EXIST
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+				panic(err)
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(b.GetStatus())
+	}
+}
+
+// HandleAuctionInfoRequest is the handler function for the API requesting the state of an asset's auction, with its
+// indicative price and imbalance if one is running
+func HandleAuctionInfoRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+
+	if e != nil {
+		panic(e)
+	} else {
+		b := assets.GetBookByID(assetID)
+		if b == nil {
+			// ERROR: ASSET DOESN'T EXIST
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusNotFound)
+			if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+				panic(err)
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(b.GetAuctionInfo())
+	}
+}
+
+// HandleQuoteRequest is the handler function for the API requesting what a market order would get, without sending it
+func HandleQuoteRequest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	assetID, e := strconv.Atoi(vars["assetID"])
+	if e != nil {
+		panic(e)
+	}
+
+	b := assets.GetBookByID(assetID)
+	if b == nil {
+		// ERROR: ASSET DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Asset Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	side := r.URL.Query().Get("side")
+	qty, err := strconv.Atoi(r.URL.Query().Get("qty"))
+	if (side != "buy" && side != "sell") || err != nil || qty <= 0 {
+		// ERROR: INVALID QUOTE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Quotes need a side (buy or sell) and a qty greater than 0"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	q := b.Quote(side == "buy", qty, replyTimeout)
+	if q == nil {
+		// ERROR: BOOK DIDN'T GET TO IT
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusGatewayTimeout)
+		if err := json.NewEncoder(w).Encode("Timed out waiting for the book to price your quote"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(q)
+}
+
 func HandleAssetsLedgerSnapshotRequest(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -74,8 +194,8 @@ func HandleAssetsLedgerSnapshotRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleOrder is the handler function for handling API order requests
-// TODO: send a channel to the Enqueue Order to get response, send back only after that's happened
+// HandleOrder is the handler function for handling API order requests.  Responds once the order's book has matched it,
+// with its execution report
 func HandleOrder(w http.ResponseWriter, r *http.Request) {
 	// read body
 	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
@@ -97,6 +217,7 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewEncoder(w).Encode(err); err != nil {
 			panic(err)
 		}
+		return
 	}
 
 	fmt.Printf("Received %s %s Order for %d shares of %s!\n", order.OrderType, order.Side, order.Qty, order.Symbol)
@@ -111,6 +232,34 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewEncoder(w).Encode("Symbol Doesn't Exist"); err != nil {
 			panic(err)
 		}
+		return
+	}
+	if users.GetLedger().GetUser(order.UserID) == nil {
+		// ERROR: ORDER NOT ATTRIBUTED TO A REAL USER
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("User Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(order.ClientOrderID) > book.MaxClientOrderIDLength {
+		// ERROR: CLIENT ORDER ID TOO LONG
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode(fmt.Sprintf("Client order IDs can't be longer than %d characters", book.MaxClientOrderIDLength)); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if _, sent := book.FindClientOrder(order.UserID, order.ClientOrderID); order.ClientOrderID != "" && sent {
+		// A retry of an order the user already sent, which the book answers with the original's report.  Skip the rest
+		// of the checks, since the book may look different now
+		reply := make(chan *book.ExecutionReport, 1)
+		order.Reply = reply
+		b.EnqueueOrder(&order)
+		respondWithReport(w, reply, http.StatusCreated)
+		return
 	}
 	if order.Side != "buy" && order.Side != "sell" {
 		// Make sure its either a Buy or a Sell
@@ -120,27 +269,174 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 		if err := json.NewEncoder(w).Encode("Error: didn't specify order side!"); err != nil {
 			panic(err)
 		}
+		return
 	}
-	if order.OrderType != "market" && order.OrderType != "limit" {
-		// Make sure its either a market or limit order
-		// TODO: Add stop and shit
+	if !book.ValidOrderType(order.OrderType) {
+		// Make sure its a market, limit, or one of the stop orders
 		// ERROR: NOT AN ACCEPTABLE ORDER TYPE
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode("Invalid order type!"); err != nil {
 			panic(err)
 		}
+		return
 	}
-	if order.Qty <= 0 {
+	if ((order.OrderType == "limit" && order.Peg == "") || order.OrderType == "stop_limit") && order.LimitPrice <= 0 {
+		// Pegged orders get their price from the book, every other limit order needs one
+		// ERROR: LIMIT ORDER WITHOUT A LIMIT PRICE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Limit orders need a limit greater than 0"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if (order.OrderType == "stop" || order.OrderType == "stop_limit") && order.StopPrice <= 0 {
+		// ERROR: STOP ORDER WITHOUT A STOP PRICE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Stop orders need a stop_price greater than 0"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.OrderType == "trailing_stop" || order.OrderType == "trailing_stop_limit" {
+		// Make sure it trails by exactly one of an amount or a percentage
+		if (order.TrailAmount > 0) == (order.TrailPercent > 0) || order.TrailAmount < 0 || order.TrailPercent < 0 || order.TrailPercent >= 100 || order.LimitOffset < 0 {
+			// ERROR: INVALID TRAIL
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode("Trailing stops need either a trail_amount greater than 0 or a trail_percent between 0 and 100"); err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
+	if order.DisplayQty < 0 {
+		// ERROR: INVALID ICEBERG DISPLAY QUANTITY
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Display quantity can't be negative"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.Hidden && (order.OrderType != "limit" || order.DisplayQty > 0) {
+		// Hidden orders don't show any of their shares, so can't be icebergs either
+		// ERROR: INVALID HIDDEN ORDER
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Only limit orders can be hidden, and hidden orders can't have a display quantity"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.MinQty < 0 || order.MinQty > order.Qty || ((order.AllOrNone || order.MinQty > 0) && order.DisplayQty > 0) {
+		// Icebergs fill a slice at a time, so can't promise a minimum either
+		// ERROR: INVALID EXECUTION CONSTRAINT
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Min qty must be between 0 and qty, and all or none and min qty orders can't have a display quantity"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	// Orders without a time in force rest until cancelled
+	order.TimeInForce = strings.ToLower(order.TimeInForce)
+	if order.TimeInForce == "" {
+		order.TimeInForce = book.TimeInForceGTC
+	}
+	if !book.ValidTimeInForce(order.TimeInForce) {
+		// ERROR: UNKNOWN TIME IN FORCE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Invalid time in force! Must be one of gtc, day, ioc, fok, gtd"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.TimeInForce == book.TimeInForceGTD && order.ExpireTime <= time.Now().Unix() {
+		// ERROR: GOOD TILL DATE ORDER ALREADY EXPIRED
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Good till date orders need an expire_time in the future"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.PostOnly && (order.OrderType == "market" || order.OrderType == "market_to_limit" || order.OrderType == "stop" || order.OrderType == "trailing_stop" ||
+		order.TimeInForce == book.TimeInForceIOC || order.TimeInForce == book.TimeInForceFOK) {
+		// Post only orders have to be able to rest on the book
+		// ERROR: POST ONLY ORDER THAT CAN'T REST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Post only orders must be limit orders that can rest on the book (not ioc or fok)"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.Peg != "" && (!book.ValidPeg(order.Peg) || order.OrderType != "limit" || order.PegCap < 0 ||
+		order.TimeInForce == book.TimeInForceIOC || order.TimeInForce == book.TimeInForceFOK) {
+		// Pegged orders have to be limit orders that can rest on the book, following something the book can price
+		// ERROR: INVALID PEG
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Pegged orders must be limit orders that can rest on the book (not ioc or fok), pegged to one of bid, offer, mid"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.SelfTradePrevention != "" && !book.ValidSelfTradePrevention(order.SelfTradePrevention) {
+		// ERROR: UNKNOWN SELF TRADE PREVENTION MODE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Invalid stp! Must be one of cancel_newest, cancel_oldest, cancel_both, decrement_and_cancel"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.ProtectionPrice < 0 || order.MaxSlippage < 0 || ((order.ProtectionPrice > 0 || order.MaxSlippage > 0) &&
+		order.OrderType != "market" && order.OrderType != "market_to_limit" && order.OrderType != "stop" && order.OrderType != "trailing_stop") {
+		// Protection only makes sense for orders that sweep the book at any price
+		// ERROR: INVALID PROTECTION
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Only market, market_to_limit, stop and trailing_stop orders can have a protection_price or max_slippage, and neither can be negative"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.Notional < 0 || (order.Notional > 0 && (order.OrderType != "market" || order.Side != "buy" ||
+		order.Qty != 0 || order.AllOrNone || order.MinQty > 0 || order.ReduceOnly || order.TimeInForce == book.TimeInForceFOK)) {
+		// Notional orders are market buys for an amount of cash, not a number of shares
+		// ERROR: INVALID NOTIONAL ORDER
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Notional orders must be market buys without a qty, and can't be all or none, min qty, reduce only or fok"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if order.Qty <= 0 && order.Notional == 0 {
 		// ERROR: INVALID QUANTITY
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusBadRequest)
 		if err := json.NewEncoder(w).Encode("Quantity must be greater than 0"); err != nil {
 			panic(err)
 		}
+		return
+	}
+	if v := assets.CheckOrder(&order); v != nil {
+		// ERROR: BREAKS THE ASSET'S INSTRUMENT RULES (tick size, lot size, etc.)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			panic(err)
+		}
+		return
 	}
-	// Check if limit book is empty for this market order
-	if order.OrderType == "market" {
+	// Check if limit book is empty for this market order (during an auction, liquidity can still turn up before the uncross)
+	if (order.OrderType == "market" || order.OrderType == "market_to_limit") && b.GetState() == book.StateContinuous {
 		if order.Side == "buy" {
 			if b.GetBestOffer() == nil {
 				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -162,12 +458,304 @@ func HandleOrder(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Everything's good, add order to queue
+	// Everything's good, add order to queue and wait for its execution report, which has the order's ID
+	reply := make(chan *book.ExecutionReport, 1)
+	order.Reply = reply
 	b.EnqueueOrder(&order)
 
+	respondWithReport(w, reply, http.StatusCreated)
+}
+
+// HandleAmendOrder is the handler function for API requests to change the price and/or quantity of a resting order
+func HandleAmendOrder(w http.ResponseWriter, r *http.Request) {
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	// Fill amendment with details from req body: user_id, the new qty and/or limit, and optionally symbol
+	var amendment book.OrderSchema
+	if err := json.Unmarshal(body, &amendment); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	orderID, found := orderIDFromRequest(r, amendment.UserID)
+	if !found {
+		// ERROR: NO ORDER WITH THAT CLIENT ORDER ID
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Order Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	amendment.ClientOrderID = mux.Vars(r)["clientOrderID"]
+
+	// Without a symbol, the order ID is enough to find its book
+	var b *book.Book
+	if amendment.Symbol == "" {
+		b, amendment.Symbol = assets.GetBookByOrderID(orderID)
+	} else {
+		b = assets.GetBookBySymbol(amendment.Symbol)
+	}
+	if b == nil {
+		// ERROR: SYMBOL DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Symbol Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if users.GetLedger().GetUser(amendment.UserID) == nil {
+		// ERROR: AMENDMENT NOT ATTRIBUTED TO A REAL USER
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("User Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if amendment.Qty <= 0 || amendment.LimitPrice < 0 {
+		// ERROR: INVALID QUANTITY OR PRICE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Quantity must be greater than 0, and limit can't be negative"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if v := assets.CheckAmendment(&amendment); v != nil {
+		// ERROR: BREAKS THE ASSET'S INSTRUMENT RULES (tick size, lot size, etc.)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Everything's good, send the amendment down the book's queue so it's applied between fills, and wait to hear back
+	amendment.Action = book.ActionAmend
+	amendment.OrderID = orderID
+	reply := make(chan *book.ExecutionReport, 1)
+	amendment.Reply = reply
+	b.EnqueueOrder(&amendment)
+
+	respondWithReport(w, reply, http.StatusOK)
+}
+
+// replyTimeout is how long a handler waits for a book to report back before giving up
+const replyTimeout = 5 * time.Second
+
+// HandleCancelOrder is the handler function for API requests to cancel an order.  Responds with whether the order
+// was cancelled, had already filled, had partially filled (and the rest was cancelled), or doesn't exist
+func HandleCancelOrder(w http.ResponseWriter, r *http.Request) {
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	// Fill cancel with details from req body: user_id, and optionally symbol
+	var cancel book.OrderSchema
+	if err := json.Unmarshal(body, &cancel); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	orderID, found := orderIDFromRequest(r, cancel.UserID)
+	if !found {
+		// ERROR: NO ORDER WITH THAT CLIENT ORDER ID
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("Order Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	cancel.ClientOrderID = mux.Vars(r)["clientOrderID"]
+
+	// Without a symbol, the order ID is enough to find its book
+	var b *book.Book
+	if cancel.Symbol == "" {
+		b, cancel.Symbol = assets.GetBookByOrderID(orderID)
+	} else {
+		b = assets.GetBookBySymbol(cancel.Symbol)
+	}
+	if b == nil {
+		// ERROR: SYMBOL DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Symbol Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Send the cancel down the book's queue so it's applied between fills, and wait to hear back
+	cancel.Action = book.ActionCancel
+	cancel.OrderID = orderID
+	reply := make(chan *book.ExecutionReport, 1)
+	cancel.Reply = reply
+	b.EnqueueOrder(&cancel)
+
+	respondWithReport(w, reply, http.StatusOK)
+}
+
+// HandleOrderStatusRequest is the handler function for API requests for the state of an order, found by its ID (or
+// client order ID) alone.  The owner's user_id goes in the query string; anyone else gets 404, same as for an order that
+// doesn't exist
+func HandleOrderStatusRequest(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		// ERROR: NO USER
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Order status requests need the owner's user_id"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	orderID, found := orderIDFromRequest(r, userID)
+	if b, _ := assets.GetBookByOrderID(orderID); found && b != nil {
+		if state, exists := b.GetOrder(orderID, userID); exists {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusOK)
+			if err := json.NewEncoder(w).Encode(state); err != nil {
+				panic(err)
+			}
+			return
+		}
+	}
+	// ERROR: ORDER DOESN'T EXIST
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusNotFound)
+	if err := json.NewEncoder(w).Encode("Order Doesn't Exist"); err != nil {
+		panic(err)
+	}
+}
+
+// orderIDFromRequest returns the ID of the order named in the route of request r, either by its order ID or by the
+// client order ID userID gave it.  Returns false if userID hasn't used that client order ID
+func orderIDFromRequest(r *http.Request, userID int) (int, bool) {
+	vars := mux.Vars(r)
+	if clientOrderID, byClient := vars["clientOrderID"]; byClient {
+		return book.FindClientOrder(userID, clientOrderID)
+	}
+	orderID, e := strconv.Atoi(vars["orderID"])
+	if e != nil {
+		panic(e)
+	}
+	return orderID, true
+}
+
+// respondWithReport waits for a book to send back an execution report on reply, and responds with it.
+// Reports on orders that were found and accepted get status; rejected orders get 422 and unknown orders 404
+func respondWithReport(w http.ResponseWriter, reply chan *book.ExecutionReport, status int) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	select {
+	case report := <-reply:
+		switch report.Status {
+		case book.StatusRejected:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case book.StatusNotFound:
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(status)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			panic(err)
+		}
+	case <-time.After(replyTimeout):
+		w.WriteHeader(http.StatusGatewayTimeout)
+		if err := json.NewEncoder(w).Encode("Timed out waiting for the book to process your order"); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// selfTradePreventionSchema defines the schema for setting an account's self trade prevention mode over http
+type selfTradePreventionSchema struct {
+	Mode string `json:"mode"`
+}
+
+// HandleSetSelfTradePrevention is the handler function for API requests to set the self trade prevention mode used
+// for a user's orders that don't set their own.  An empty mode goes back to the exchange default (cancel newest)
+func HandleSetSelfTradePrevention(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, e := strconv.Atoi(vars["userID"])
+	if e != nil {
+		panic(e)
+	}
+
+	// read body
+	body, e := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if e != nil {
+		panic(e)
+	}
+
+	// Close IO
+	if err := r.Body.Close(); err != nil {
+		panic(err)
+	}
+
+	var setting selfTradePreventionSchema
+	if err := json.Unmarshal(body, &setting); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // unprocessable entity
+		if err := json.NewEncoder(w).Encode(err); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	u := users.GetLedger().GetUser(userID)
+	if u == nil {
+		// ERROR: USER DOESN'T EXIST
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		if err := json.NewEncoder(w).Encode("User Doesn't Exist"); err != nil {
+			panic(err)
+		}
+		return
+	}
+	if setting.Mode != "" && !book.ValidSelfTradePrevention(setting.Mode) {
+		// ERROR: UNKNOWN SELF TRADE PREVENTION MODE
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusBadRequest)
+		if err := json.NewEncoder(w).Encode("Invalid mode! Must be one of cancel_newest, cancel_oldest, cancel_both, decrement_and_cancel"); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	u.SetSelfTradePrevention(setting.Mode)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode("Your Order Has Been Processed!"); err != nil {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(setting); err != nil {
 		panic(err)
 	}
 }
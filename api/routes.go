@@ -25,6 +25,13 @@ func NewRouter() *mux.Router {
 			Name(route.Name).
 			Handler(route.HandlerFunc)
 	}
+	for _, route := range adminRoutes {
+		router.
+			Methods(route.Method).
+			Path(route.Pattern).
+			Name(route.Name).
+			Handler(route.HandlerFunc)
+	}
 
 	return router
 }
@@ -45,6 +52,35 @@ var apiRoutes = routes{
 		"/api/{assetID}/data/LOBSnapshot",
 		HandleBookSnapshotRequest,
 	},
+	// Route to get the instrument rules (tick size, lot size, etc.) of asset with assetID
+	route{
+		"Instrument Rules",
+		"GET",
+		"/api/{assetID}/data/rules",
+		HandleRulesRequest,
+	},
+	// Route to get the trading status (continuous, halted, ...) and price bands of asset with assetID
+	route{
+		"Trading Status",
+		"GET",
+		"/api/{assetID}/data/status",
+		HandleStatusRequest,
+	},
+	// Route to get the auction state of asset with assetID, with the indicative price and imbalance while an auction runs
+	route{
+		"Auction Info",
+		"GET",
+		"/api/{assetID}/data/auction",
+		HandleAuctionInfoRequest,
+	},
+	// Route to get a quote for a market order for asset with assetID, without sending it
+	// Side and qty specified in the query string (?side=buy&qty=100)
+	route{
+		"Quote",
+		"GET",
+		"/api/{assetID}/data/quote",
+		HandleQuoteRequest,
+	},
 	// Route to get snapshot of order book for asset with assetID
 	route{
 		"Transaction Ledger Snapshot (For Asset)",
@@ -61,4 +97,84 @@ var apiRoutes = routes{
 		"/api/order",
 		HandleOrder,
 	},
+	// Route to get the state of the order with orderID, on whichever asset's book it's on
+	// Owner specified in the query string (?user_id=1)
+	route{
+		"Order Status",
+		"GET",
+		"/api/order/{orderID}",
+		HandleOrderStatusRequest,
+	},
+	// Route to amend the resting order with orderID
+	// New qty and/or limit specified in request.body; lowering qty keeps the order's place in line, anything else loses it
+	route{
+		"Amend Order",
+		"PUT",
+		"/api/order/{orderID}",
+		HandleAmendOrder,
+	},
+	// Route to cancel the order with orderID
+	// Owner (and optionally symbol) specified in request.body
+	route{
+		"Cancel Order",
+		"DELETE",
+		"/api/order/{orderID}",
+		HandleCancelOrder,
+	},
+	// The same three, for the order its owner gave clientOrderID (owner given the same way)
+	route{
+		"Client Order Status",
+		"GET",
+		"/api/order/client/{clientOrderID}",
+		HandleOrderStatusRequest,
+	},
+	route{
+		"Amend Client Order",
+		"PUT",
+		"/api/order/client/{clientOrderID}",
+		HandleAmendOrder,
+	},
+	route{
+		"Cancel Client Order",
+		"DELETE",
+		"/api/order/client/{clientOrderID}",
+		HandleCancelOrder,
+	},
+	// ACCOUNTS
+	// Route to set the self trade prevention mode for orders from the user with userID
+	// Mode specified in request.body
+	route{
+		"Self Trade Prevention",
+		"PUT",
+		"/api/user/{userID}/selfTradePrevention",
+		HandleSetSelfTradePrevention,
+	},
+}
+
+// adminRoutes control trading in an asset, see admin.go
+var adminRoutes = routes{
+	// Route to start a call auction for asset with assetID
+	// Duration specified in request.body
+	route{
+		"Start Auction",
+		"POST",
+		"/admin/{assetID}/auction",
+		HandleStartAuction,
+	},
+	// Route to halt trading in asset with assetID
+	// Note explaining the halt specified in request.body
+	route{
+		"Halt",
+		"POST",
+		"/admin/{assetID}/halt",
+		HandleHalt,
+	},
+	// Route to resume trading in halted asset with assetID
+	// Reopening auction duration specified in request.body
+	route{
+		"Resume",
+		"POST",
+		"/admin/{assetID}/resume",
+		HandleResume,
+	},
 }
@@ -14,6 +14,7 @@ type Asset struct {
 	id     int
 	name   string
 	ticker string
+	rules  Rules // Instrument rules orders have to follow (see rules.go)
 	// TODO: Eventually add ALL stats here (market cap, daily Vol, Spotify plays, etc.)
 }
 
@@ -40,10 +41,16 @@ func Initialize() {
 	prevID = 0
 }
 
-// CreateAsset adds a new asset with name and ticker to the data structures, and starts concurrently handling orders from queue
-func CreateAsset(name string, ticker string) {
+// CreateAsset adds a new asset with name and ticker to the data structures, and starts concurrently handling orders from queue.
+// policy decides how the asset's book matches orders at the same price (book.FIFO{}, book.ProRata{}, book.TopOrderProRata{}); nil means FIFO.
+// rules are the instrument rules its orders have to follow, and bands its book's circuit breakers (book.DefaultPriceBands
+// for the usual ones, book.PriceBands{} for none)
+func CreateAsset(name string, ticker string, policy book.MatchingPolicy, rules Rules, bands book.PriceBands) {
 	prevID++
-	newBook := book.NewBook(prevID)
+	newBook := book.NewBook(prevID, policy)
+	// Before anyone can find the book, so the bands and tick size are in place before its first order
+	newBook.SetPriceBands(bands)
+	newBook.SetTickSize(rules.TickSize)
 	// populate book with random limits
 	populate(newBook)
 	Books[prevID] = newBook
@@ -52,6 +59,7 @@ func CreateAsset(name string, ticker string) {
 	asset.id = prevID
 	asset.name = name
 	asset.ticker = ticker
+	asset.rules = rules
 	Assets[prevID] = asset
 
 	IDs[ticker] = prevID
@@ -81,7 +89,8 @@ func populate(b *book.Book) {
 		if lim > 40 {
 			buyOrSell = false
 		}
-		b.NewOrder(buyOrSell, rand.Intn(450)+50, lim)
+		// Attribute each order to one of the users seeded by users.Initialize (ids 1-20)
+		b.NewOrder(rand.Intn(20)+1, buyOrSell, rand.Intn(450)+50, lim)
 	}
 
 	// Let's cancel half of them randomly
@@ -108,3 +117,34 @@ func GetBookBySymbol(symbol string) *book.Book {
 	}
 	return nil
 }
+
+// GetBookByOrderID is an accessor function to get the pointer to the book order orderID was sent to, and the symbol of
+// its asset; nil and "" if there's no such order
+func GetBookByOrderID(orderID int) (*book.Book, string) {
+	b := book.FindOrder(orderID)
+	if b == nil {
+		return nil, ""
+	}
+	if a := GetAssetByID(b.GetAssetID()); a != nil {
+		return b, a.ticker
+	}
+	return nil, ""
+}
+
+// GetAssetByID is an accessor function to get the pointer to the asset with id
+func GetAssetByID(id int) *Asset {
+	if a, exists := Assets[id]; exists {
+		return a
+	}
+	return nil
+}
+
+// GetAssetBySymbol is an accessor function to get the pointer to the asset with symbol symbol
+func GetAssetBySymbol(symbol string) *Asset {
+	if id, exists := IDs[symbol]; exists {
+		if a, exists := Assets[id]; exists {
+			return a
+		}
+	}
+	return nil
+}
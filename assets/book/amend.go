@@ -0,0 +1,89 @@
+package book
+
+import (
+	"time"
+)
+
+// Amendments are cancel/replaces of a resting order.  They come down the OrderQueue like any other order
+// (OrderSchema.Action == ActionAmend), so they are applied on the book's matching goroutine and can't interleave with a fill.
+//
+// Decreasing the quantity at the same price keeps the order's place in its Limit's queue.
+// Changing the price or increasing the quantity is a replace: the order keeps its ID, but goes to the back of the
+// queue at its new price, and is matched first if the new price crosses the spread (unless the book is in an auction).
+
+// amend applies amendment a (OrderID, Qty, LimitPrice; a LimitPrice of 0 keeps the order's price) to the resting order
+// it names.  Reports not_found if the order isn't resting on the book (already filled, cancelled, or never existed) or
+// isn't owned by the user asking.  Otherwise the report has any fills from re-matching the order at its new price
+// (FilledQty and AvgPrice are theirs), and its CumQty is everything the order has filled, before and during the amendment
+func (b *Book) amend(a *OrderSchema) *ExecutionReport {
+	r := newReport(a.OrderID)
+	o, exists := b.OrderMap[a.OrderID]
+	if !exists || o.userID != a.UserID {
+		r.Status = StatusNotFound
+		return r
+	}
+
+	if o.peg != "" && a.LimitPrice != 0 && a.LimitPrice != o.limit {
+		// The book sets the price of pegged orders
+		return rejection(a, "pegged orders can only have their qty amended")
+	}
+
+	newPrice := a.LimitPrice
+	if newPrice == 0 {
+		newPrice = o.limit
+	}
+	newQty := a.Qty
+	open := o.shares + o.reserve
+
+	if newPrice == o.limit && newQty <= open {
+		// Quantity decrease, keeps queue position
+		b.shrink(o, newQty)
+		r.CumQty = o.filled
+		r.settle(o.filled+newQty, newQty)
+		return r
+	}
+
+	// Price change or quantity increase, pull the order and replace it as if it just arrived
+	prior := o.filled
+	b.Cancel(o.idNumber)
+	o.limit = newPrice
+	o.entryTime = time.Now().Unix()
+	remaining, stopped := newQty, false
+	t := taker{o.idNumber, o.userID, o.buyOrSell, o.stp, 0}
+	need := minimumFill(o.allOrNone, o.minQty, newQty)
+	if b.state != StateAuction && (need == 0 || b.fillable(t, b.bandLimit(o.buyOrSell, newPrice), need) >= need) {
+		// During an auction it just waits for the uncross at its new price, and an order with a constraint (see
+		// constraints.go) waits if it can't meet it
+		remaining, stopped = b.sweep(t, newQty, newPrice, r)
+	}
+	o.filled += r.FilledQty
+	r.CumQty = o.filled
+	if remaining > 0 && !stopped {
+		o.shares = remaining
+		o.reserve = 0
+		o.setDisplay(o.displayQty)
+		b.place(o)
+	} else {
+		// Whatever self trade prevention stopped is cancelled, and the order is done; cancels and status requests see it
+		// that way from closedOrders
+		o.shares, o.reserve = remaining, 0
+		remaining = 0
+	}
+	r.settle(prior+newQty, remaining)
+	return r
+}
+
+// shrink cuts resting order o down to open unfilled shares (fewer than it has) without losing its place in the queue.
+// Shares come off the iceberg reserve first, then off what's displayed
+func (b *Book) shrink(o *Order, open int) {
+	l := o.parentLimit
+	cut := o.shares + o.reserve - open
+	fromReserve := cut
+	if o.reserve < fromReserve {
+		fromReserve = o.reserve
+	}
+	o.reserve -= fromReserve
+	l.reserveVolume -= fromReserve
+	o.shares -= cut - fromReserve
+	l.take(o, cut-fromReserve)
+}
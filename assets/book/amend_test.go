@@ -0,0 +1,57 @@
+package book
+
+import "testing"
+
+// amend sends amendment a of order orderID to b, and waits for its report
+func amend(b *Book, orderID int, a OrderSchema) *ExecutionReport {
+	a.Action, a.OrderID = ActionAmend, orderID
+	return send(b, &a)
+}
+
+// Cutting an order's qty keeps its place in the queue, raising it sends the order to the back
+func TestAmendQueuePosition(t *testing.T) {
+	b := startBook(nil)
+	first := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	second := &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	send(b, first)
+	send(b, second)
+
+	if r := amend(b, first.OrderID, OrderSchema{UserID: 2, Qty: 3}); r.Status != StatusNew || r.RemainingQty != 3 {
+		t.Fatalf("cut to 3: %s with %d open", r.Status, r.RemainingQty)
+	}
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 2})
+	if s, _ := b.GetOrder(first.OrderID, 2); s.FilledQty != 2 || s.RemainingQty != 1 {
+		t.Errorf("cut order lost its place: %+v", s)
+	}
+
+	amend(b, first.OrderID, OrderSchema{UserID: 2, Qty: 5})
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 5})
+	if s, _ := b.GetOrder(second.OrderID, 3); s.Status != StatusFilled {
+		t.Errorf("raised order kept its place: second order %+v", s)
+	}
+	if s, _ := b.GetOrder(first.OrderID, 2); s.FilledQty != 2 || s.RemainingQty != 5 {
+		t.Errorf("raised order %+v, want 2 filled and 5 open", s)
+	}
+}
+
+// An amendment's fills, filled qty and average price go together; cum qty counts what the order filled before too
+func TestAmendReport(t *testing.T) {
+	b := startBook(nil)
+	o := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50}
+	send(b, o)
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 4})
+
+	r := amend(b, o.OrderID, OrderSchema{UserID: 2, Qty: 3})
+	if r.Status != StatusPartiallyFilled || r.FilledQty != 0 || r.AvgPrice != 0 || r.CumQty != 4 || r.RemainingQty != 3 {
+		t.Errorf("cut: %+v", r)
+	}
+
+	send(b, &OrderSchema{UserID: 3, Side: "buy", OrderType: "limit", Qty: 2, LimitPrice: 45})
+	r = amend(b, o.OrderID, OrderSchema{UserID: 2, Qty: 3, LimitPrice: 45})
+	if r.Status != StatusPartiallyFilled || len(r.Fills) != 1 || r.FilledQty != 2 || r.AvgPrice != 45 || r.CumQty != 6 || r.RemainingQty != 1 {
+		t.Errorf("repriced: %+v", r)
+	}
+	if s, _ := b.GetOrder(o.OrderID, 2); s.FilledQty != 6 || s.RemainingQty != 1 || s.LimitPrice != 45 {
+		t.Errorf("after repricing %+v, want 6 filled and 1 open at 45", s)
+	}
+}
@@ -0,0 +1,416 @@
+package book
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HuKeping/rbtree"
+
+	"exchange/users"
+)
+
+// A call auction (opening, closing, or any other time) stops a book from matching for a while.  Orders keep coming
+// down the OrderQueue, but instead of matching: limit orders rest on the book (which may leave it crossed) and market
+// orders wait in auctionOrders.  Cancels and amendments still work as usual.
+//
+// When the auction ends, the book uncrosses at a single clearing price: the price that executes the most shares,
+// then the one leaving the smallest imbalance, then the one closest to the last market price, then the lowest.
+// Everything at or better than the clearing price executes at the clearing price, market orders first, then by
+// price and time (the book's MatchingPolicy only applies to continuous matching).  Market orders that don't fill at
+// the uncross are cancelled.  The clearing price becomes the market price (and the static reference price for the
+// price bands, see bands.go), and continuous matching resumes.
+//
+// While the auction runs, the indicative uncross (what would happen if it ended right now) is published after every
+// order, see GetAuctionInfo.
+
+// AuctionInfo is the published state of a book's auction
+type AuctionInfo struct {
+	State           string `json:"state"`
+	IndicativePrice int    `json:"indicative_price"` // Price the auction would uncross at right now, 0 if nothing would trade
+	MatchedVolume   int    `json:"matched_volume"`   // Shares that would trade at IndicativePrice
+	Imbalance       int    `json:"imbalance"`        // Shares on the heavier side that wouldn't trade at IndicativePrice
+	ImbalanceSide   string `json:"imbalance_side"`   // "buy" or "sell", empty if there's no imbalance
+	EndTime         int64  `json:"end_time"`         // Unix time the auction uncrosses
+}
+
+// GetAuctionInfo returns the indicative uncross of the auction the book is running, or just its state if it isn't running one
+func (b *Book) GetAuctionInfo() AuctionInfo {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if info := b.auctionInfo; info != nil {
+		return *info
+	}
+	return AuctionInfo{State: b.state}
+}
+
+// StartAuction stops continuous matching and collects orders for duration, then uncrosses.  Starting an auction while
+// one is running pushes its end back to duration from now.  A halted book has to be resumed instead
+func (b *Book) StartAuction(duration time.Duration) {
+	b.controls <- func() {
+		if b.state != StateHalted {
+			b.startAuction(duration)
+		}
+	}
+}
+
+func (b *Book) startAuction(duration time.Duration) {
+	if b.auctionTimer != nil {
+		b.auctionTimer.Stop()
+	}
+	b.state = StateAuction
+	b.stateReason = ReasonCall
+	b.auctionEnd = time.Now().Add(duration).Unix()
+	b.auctionTimer = time.NewTimer(duration)
+	b.publishAuctionInfo()
+}
+
+// auctionC is the channel MatchOrders waits on for the end of the auction; nil (blocks forever) if there isn't one
+func (b *Book) auctionC() <-chan time.Time {
+	if b.auctionTimer == nil {
+		return nil
+	}
+	return b.auctionTimer.C
+}
+
+// collect takes market or limit order o into the auction without matching it
+func (b *Book) collect(o *OrderSchema) *ExecutionReport {
+	if !o.rests() {
+		return rejection(o, "ioc and fok orders can't join an auction")
+	}
+	if o.Peg != "" {
+		// There's no spread to peg to until the uncross
+		return rejection(o, "pegged orders can't join an auction")
+	}
+	if o.Notional > 0 {
+		// There's no telling how many shares the cash buys until the clearing price is known
+		return rejection(o, "notional orders can't join an auction")
+	}
+	if o.AllOrNone || o.MinQty > 0 {
+		// Everything at the clearing price is shared out together, there's no way to meet a minimum
+		return rejection(o, "all or none and min qty orders can't join an auction")
+	}
+	if o.PostOnly {
+		// Everything trades as the same side of an uncross, there's no making or taking
+		return rejection(o, "post only orders can't join an auction")
+	}
+	if o.ReduceOnly {
+		if reason := b.checkReduceOnly(o); reason != "" {
+			return rejection(o, reason)
+		}
+	}
+
+	b.holdForAuction(o, o.Qty)
+	r := newReport(o.OrderID)
+	r.settle(o.Qty, o.Qty)
+	return r
+}
+
+// holdForAuction adds the unfilled shares of market or limit order o to the auction: limit orders rest on the book,
+// market orders wait in auctionOrders
+func (b *Book) holdForAuction(o *OrderSchema, shares int) {
+	if o.OrderType != "limit" && o.ProtectionPrice > 0 {
+		// It can't trade past its protection price, so it may as well be a limit order there (see protection.go)
+		o.OrderType = "limit"
+		o.LimitPrice = o.ProtectionPrice
+	}
+	if o.OrderType == "limit" {
+		b.rest(o, o.Side == "buy", shares)
+		return
+	}
+	held := *o
+	held.Qty, held.filled = shares, o.Qty-shares
+	b.auctionOrders = append(b.auctionOrders, &held)
+}
+
+// publishAuctionInfo works out the indicative uncross for the current state of the book
+func (b *Book) publishAuctionInfo() {
+	price, volume, imbalance := b.clearing()
+	info := &AuctionInfo{StateAuction, price, volume, imbalance, "", b.auctionEnd}
+	if imbalance > 0 {
+		info.ImbalanceSide = "buy"
+	} else if imbalance < 0 {
+		info.ImbalanceSide = "sell"
+		info.Imbalance = -imbalance
+	}
+	b.auctionInfo = info
+}
+
+// priceLevel is the price and total (displayed, reserve and hidden) volume of a Limit
+type priceLevel struct {
+	price  int
+	volume int
+}
+
+// levels returns every Limit on the buy (or sell) side of the book
+func (b *Book) levels(buyOrSell bool) []priceLevel {
+	levels := make([]priceLevel, 0)
+	tree := b.sellTree
+	if buyOrSell {
+		tree = b.BuyTree
+	}
+	tree.Ascend(tree.Min(), func(item rbtree.Item) bool {
+		l := item.(*Limit)
+		// Constrained orders sit out the auction
+		levels = append(levels, priceLevel{l.LimitPrice, l.TotalLiquidity() - l.constrainedVolume()})
+		return true
+	})
+	return levels
+}
+
+// clearing returns the price the book would uncross at right now, the shares that would execute, and the imbalance
+// left at that price (positive if buys are left over, negative if sells are).  price is 0 if nothing would execute
+func (b *Book) clearing() (int, int, int) {
+	marketBuys, marketSells := 0, 0
+	for _, o := range b.auctionOrders {
+		if o.Side == "buy" {
+			marketBuys += o.Qty
+		} else {
+			marketSells += o.Qty
+		}
+	}
+	buys, sells := b.levels(true), b.levels(false)
+
+	// Every limit price is a candidate.  Market orders alone have no price to trade at but the last one
+	candidates := make([]int, 0, len(buys)+len(sells))
+	for _, l := range buys {
+		candidates = append(candidates, l.price)
+	}
+	for _, l := range sells {
+		candidates = append(candidates, l.price)
+	}
+	if len(candidates) == 0 && b.marketPrice > 0 {
+		candidates = append(candidates, b.marketPrice)
+	}
+
+	bestPrice, bestVolume, bestImbalance := 0, 0, 0
+	for _, p := range candidates {
+		// Buys willing to pay p, sells willing to take p
+		demand, supply := marketBuys, marketSells
+		for _, l := range buys {
+			if l.price >= p {
+				demand += l.volume
+			}
+		}
+		for _, l := range sells {
+			if l.price <= p {
+				supply += l.volume
+			}
+		}
+		volume := demand
+		if supply < volume {
+			volume = supply
+		}
+		if volume == 0 {
+			continue
+		}
+		imbalance := demand - supply
+
+		if bestVolume == 0 || b.betterClearing(p, volume, imbalance, bestPrice, bestVolume, bestImbalance) {
+			bestPrice, bestVolume, bestImbalance = p, volume, imbalance
+		}
+	}
+	return bestPrice, bestVolume, bestImbalance
+}
+
+// betterClearing reports whether uncrossing at price beats uncrossing at bestPrice
+func (b *Book) betterClearing(price, volume, imbalance, bestPrice, bestVolume, bestImbalance int) bool {
+	if volume != bestVolume {
+		return volume > bestVolume
+	}
+	if abs(imbalance) != abs(bestImbalance) {
+		return abs(imbalance) < abs(bestImbalance)
+	}
+	if b.marketPrice > 0 && abs(price-b.marketPrice) != abs(bestPrice-b.marketPrice) {
+		return abs(price-b.marketPrice) < abs(bestPrice-b.marketPrice)
+	}
+	return price < bestPrice
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// participant is an order taking part in the uncross: a resting limit order, or a market order collected by the auction
+type participant struct {
+	orderID int
+	userID  int
+	open    int
+	resting *Order       // nil for market orders
+	held    *OrderSchema // The market order, nil for resting orders
+}
+
+// participants returns the orders on the buy (or sell) side that execute at price, in the order they get filled
+func (b *Book) participants(buyOrSell bool, price int) []*participant {
+	ps := make([]*participant, 0)
+	for _, o := range b.auctionOrders {
+		if (o.Side == "buy") == buyOrSell {
+			ps = append(ps, &participant{o.OrderID, o.UserID, o.Qty, nil, o})
+		}
+	}
+
+	add := func(item rbtree.Item) bool {
+		l := item.(*Limit)
+		// A buy (or sell) at this limit is willing to trade at price
+		if !crosses(buyOrSell, price, l.LimitPrice) {
+			return false
+		}
+		// Hidden orders last at each price
+		for _, o := range append(append([]*Order{}, l.orders...), l.hidden...) {
+			if o.constrained() {
+				continue
+			}
+			ps = append(ps, &participant{o.idNumber, o.userID, o.shares + o.reserve, o, nil})
+		}
+		return true
+	}
+	if buyOrSell {
+		if best := b.bestBid(); best != nil {
+			b.BuyTree.Descend(best, add)
+		}
+	} else {
+		if best := b.bestOffer(); best != nil {
+			b.sellTree.Ascend(best, add)
+		}
+	}
+	return ps
+}
+
+// uncross ends the auction, executing everything that crosses at the clearing price
+func (b *Book) uncross() {
+	b.auctionTimer = nil
+	price, volume, _ := b.clearing()
+	if volume > 0 {
+		traded := b.executeAuction(price, volume)
+		b.marketPrice = price
+		b.staticRef = price
+		fmt.Printf("Auction uncrossed %d shares at %d\n", traded, price)
+	} else {
+		fmt.Printf("Auction uncrossed with nothing to trade\n")
+	}
+
+	// Market orders never rest, whatever didn't fill is cancelled.  Market to limit orders rest at the clearing price
+	for _, o := range b.auctionOrders {
+		remaining := o.Qty
+		o.Qty += o.filled // The whole order again, so what it filled counts towards it
+		if o.OrderType == "market_to_limit" && remaining > 0 && volume > 0 {
+			o.OrderType = "limit"
+			o.LimitPrice = price
+			b.rest(o, o.Side == "buy", remaining)
+			if o.ReduceOnly {
+				b.trimReduceOnly(o.UserID)
+			}
+			continue
+		}
+		r := newReport(o.OrderID)
+		r.FilledQty = o.filled
+		r.settle(o.Qty, 0)
+		b.retire(o, r)
+	}
+	b.auctionOrders = nil
+	b.auctionInfo = nil
+	b.state = StateContinuous
+	b.stateReason = ""
+
+	b.releaseStops()
+	b.repeg()
+}
+
+// executeAuction trades up to volume shares between the buys and sells that cross at price, all at price.
+// Returns the number of shares traded
+func (b *Book) executeAuction(price int, volume int) int {
+	ledger := users.GetLedger()
+	buys, sells := b.participants(true, price), b.participants(false, price)
+
+	traded := 0
+	i, j := 0, 0
+	for traded < volume && i < len(buys) && j < len(sells) {
+		buy, sell := buys[i], sells[j]
+		if buy.userID == sell.userID {
+			// Never trade with yourself; the newer of the two orders drops out of the auction
+			if buy.orderID > sell.orderID {
+				b.dropOut(buy)
+				i++
+			} else {
+				b.dropOut(sell)
+				j++
+			}
+			continue
+		}
+
+		// Reduce only orders can't trade past their owner's position, which the auction's earlier trades may have moved
+		b.limitReduceOnly(buy, true)
+		b.limitReduceOnly(sell, false)
+		if buy.open == 0 || sell.open == 0 {
+			if buy.open == 0 {
+				i++
+			}
+			if sell.open == 0 {
+				j++
+			}
+			continue
+		}
+
+		qty := volume - traded
+		if buy.open < qty {
+			qty = buy.open
+		}
+		if sell.open < qty {
+			qty = sell.open
+		}
+		if !ledger.RecordTrade(b.assetID, qty, price, buy.userID, sell.userID) {
+			break
+		}
+		traded += qty
+
+		for _, p := range []*participant{buy, sell} {
+			p.open -= qty
+			if p.resting != nil {
+				b.fillResting(p.resting, qty)
+			} else {
+				p.held.Qty -= qty
+				p.held.filled += qty
+			}
+		}
+		if buy.open == 0 {
+			i++
+		}
+		if sell.open == 0 {
+			j++
+		}
+	}
+	return traded
+}
+
+// limitReduceOnly cuts reduce-only participant p, a buy (or sell), down to the position it reduces.  Resting orders are
+// trimmed on the book along with it
+func (b *Book) limitReduceOnly(p *participant, buyOrSell bool) {
+	if p.held != nil {
+		if !p.held.ReduceOnly {
+			return
+		}
+		if room := b.reducible(p.userID, buyOrSell); room < p.open {
+			p.open = room
+		}
+		return
+	}
+	if !p.resting.reduceOnly {
+		return
+	}
+	b.trimReduceOnly(p.userID)
+	if resting, exists := b.OrderMap[p.resting.idNumber]; !exists || resting != p.resting {
+		p.open = 0
+	} else if open := resting.shares + resting.reserve; open < p.open {
+		p.open = open
+	}
+}
+
+// dropOut takes p out of the auction, cancelling it if it's resting on the book
+func (b *Book) dropOut(p *participant) {
+	if p.resting != nil {
+		b.Cancel(p.resting.idNumber)
+	}
+	p.open = 0
+}
@@ -0,0 +1,42 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// A call auction collects orders without matching them, publishes where it would uncross, and uncrosses at a single
+// price when it ends
+func TestCallAuction(t *testing.T) {
+	b := startBook(nil)
+	b.StartAuction(time.Hour)
+	flush(b)
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 10, LimitPrice: 52}); r.Status != StatusNew {
+		t.Errorf("order %s during the auction, want new", r.Status)
+	}
+	send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 10, LimitPrice: 50})
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 49})
+	if r := send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 51}); r.FilledQty != 0 {
+		t.Errorf("crossing order filled %d during the auction", r.FilledQty)
+	}
+
+	info := b.GetAuctionInfo()
+	want := AuctionInfo{StateAuction, 51, 10, 5, "sell", info.EndTime}
+	if info != want {
+		t.Errorf("auction info %+v, want %+v", info, want)
+	}
+
+	b.StartAuction(time.Millisecond)
+	waitFor(t, "the uncross", func() bool { return b.GetState() == StateContinuous })
+	for user, want := range map[int]int{4: 10, 5: 0, 2: -5, 3: -5} {
+		if p := position(b, user); p != want {
+			t.Errorf("user %d's position %d after the uncross, want %d", user, p, want)
+		}
+	}
+	if p := b.GetMarketPrice(); p != 51 {
+		t.Errorf("market price %d after uncrossing at 51", p)
+	}
+	if v51, v50 := b.GetVolumeAtLimit(51), b.GetVolumeAtLimit(50); v51 != 5 || v50 != 10 {
+		t.Errorf("%d left at 51 and %d at 50, want the 5 unsold and 10 unbought", v51, v50)
+	}
+}
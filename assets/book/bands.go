@@ -0,0 +1,76 @@
+package book
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Price bands are the book's circuit breakers.  Every trade in continuous matching has to be priced inside two bands:
+//   static:  StaticPercent around the static reference price, the clearing price of the last auction (or the first
+//            trade, if the book has never been through one)
+//   dynamic: DynamicPercent around the dynamic reference price, the last trade before the incoming order started matching
+// An order that would trade outside either band trades only up to the band, then halts the book and starts a
+// volatility auction lasting AuctionDuration.  Whatever is left of the order joins the auction if it can rest there.
+// Auction uncrosses aren't limited by the bands; the clearing price becomes the new static reference.
+
+// PriceBands configures a book's circuit breakers.  A percent of 0 turns that band off
+type PriceBands struct {
+	StaticPercent   float64
+	DynamicPercent  float64
+	AuctionDuration time.Duration // How long a volatility auction collects orders before uncrossing
+}
+
+// DefaultPriceBands are the bands every book starts with, until assets.CreateAsset sets the asset's own
+var DefaultPriceBands = PriceBands{20, 10, 30 * time.Second}
+
+// SetPriceBands changes the book's circuit breakers, from the next order on
+func (b *Book) SetPriceBands(bands PriceBands) {
+	b.controls <- func() { b.priceBands = bands }
+}
+
+// bands returns the lowest and highest prices the book can trade at right now; 0 means there's no bound
+func (b *Book) bands() (int, int) {
+	lo, hi := 0, 0
+	narrow := func(ref int, percent float64) {
+		if ref == 0 || percent == 0 {
+			return
+		}
+		l := int(math.Ceil(float64(ref) * (1 - percent/100)))
+		h := int(math.Floor(float64(ref) * (1 + percent/100)))
+		if l > lo {
+			lo = l
+		}
+		if hi == 0 || h < hi {
+			hi = h
+		}
+	}
+	narrow(b.staticRef, b.priceBands.StaticPercent)
+	narrow(b.marketPrice, b.priceBands.DynamicPercent)
+	return lo, hi
+}
+
+// inBands reports whether price is between lo and hi, as returned by bands
+func inBands(price int, lo int, hi int) bool {
+	return price >= lo && (hi == 0 || price <= hi)
+}
+
+// bandLimit narrows limitPrice, the worst price an incoming buy (or sell) will trade at, to what the bands allow
+func (b *Book) bandLimit(buyOrSell bool, limitPrice int) int {
+	lo, hi := b.bands()
+	if buyOrSell && hi != 0 && (limitPrice == noLimit || hi < limitPrice) {
+		return hi
+	}
+	if !buyOrSell && lo != 0 && (limitPrice == noLimit || lo > limitPrice) {
+		return lo
+	}
+	return limitPrice
+}
+
+// tripCircuitBreaker halts continuous trading because a trade at price would have broken through the bands, and starts
+// a volatility auction
+func (b *Book) tripCircuitBreaker(price int, lo int, hi int) {
+	fmt.Printf("Circuit breaker tripped: trade at %d outside [%d, %d]\n", price, lo, hi)
+	b.startAuction(b.priceBands.AuctionDuration)
+	b.stateReason = ReasonVolatility
+}
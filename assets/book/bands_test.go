@@ -0,0 +1,36 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// An order that would trade outside the bands trades up to them, then the book holds the rest of it in a volatility
+// auction
+func TestCircuitBreaker(t *testing.T) {
+	b := startBook(nil)
+	b.SetPriceBands(PriceBands{0, 10, 20 * time.Millisecond})
+	trade(b, 100)
+	if s := b.GetStatus(); s.LowerBand != 90 || s.UpperBand != 110 {
+		t.Fatalf("bands [%d, %d] around the last trade at 100, want [90, 110]", s.LowerBand, s.UpperBand)
+	}
+
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 105})
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 120})
+	r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10})
+	if r.FilledQty != 5 || r.AvgPrice != 105 || r.RemainingQty != 5 {
+		t.Errorf("filled %d at %.2f with %d left, want 5 at 105 and 5 held for the auction", r.FilledQty, r.AvgPrice, r.RemainingQty)
+	}
+	if s := b.GetStatus(); s.State != StateAuction || s.Reason != ReasonVolatility {
+		t.Errorf("book is %s (%s), want a volatility auction", s.State, s.Reason)
+	}
+
+	// Auctions aren't limited by the bands, and the clearing price becomes the reference
+	waitFor(t, "the uncross", func() bool { return b.GetState() == StateContinuous })
+	if p := position(b, 4); p != 10 {
+		t.Errorf("bought %d shares by the end of the auction, want 10", p)
+	}
+	if s := b.GetStatus(); s.ReferencePrice != 120 || s.LowerBand != 108 || s.UpperBand != 132 {
+		t.Errorf("reference %d and bands [%d, %d] after uncrossing at 120, want [108, 132]", s.ReferencePrice, s.LowerBand, s.UpperBand)
+	}
+}
@@ -6,7 +6,7 @@ package book
 // 		BuyTree       SellTree
 // 	Limit1, Limit2  Limit3, Limit4
 //
-// limitMap = {price1: Limit1, price2: Limit2, price3: Limit3 ... etc.}
+// buyLimits = {price1: Limit1, price2: Limit2 ... etc.}, sellLimits = {price3: Limit3, price4: Limit4 ... etc.}
 // orderMap = {id1: Order1, id2: Order2, ... etc. }
 //
 // Each Limit maintains a linked list of Orders.
@@ -17,11 +17,12 @@ package book
 //
 // Book operates under the assumption that orders are added to orderMap before added to Book
 
-// TODO: MOVE MUTEX LOCK INTO BOOK STRUCT AND MOVE ORDER QUEUE OUT SO LIMITS AND MARKETS CAN BE
-// HANDLED CONCURRENTLY
+// TODO: MOVE ORDER QUEUE OUT SO LIMITS AND MARKETS CAN BE HANDLED CONCURRENTLY
 import (
 	"fmt"
 	"log"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/HuKeping/rbtree"
@@ -29,25 +30,43 @@ import (
 	"exchange/users"
 )
 
-var curID int
-
 // Order is the basic order, added to linked list of Limit
 type Order struct {
 	idNumber    int
+	userID      int  // Owner of the order, credited/debited by the ledger when it fills
 	buyOrSell   bool // true: Buy, false: Sell
-	shares      int
+	shares      int  // Shares showing on the book; for an iceberg, what's left of the current slice
+	filled      int  // Shares filled so far, including any filled before the order rested
 	limit       int
-	entryTime   int64 // Time received by API
-	eventTime   int64 // Time matched
+	displayQty  int    // Size of each slice an iceberg order shows, 0 if the whole order is displayed
+	reserve     int    // Shares of an iceberg order not yet displayed
+	entryTime   int64  // Time received by API
+	expireTime  int64  // Time a DAY/GTD order is cancelled, 0 if it rests until cancelled
+	closedAt    int64  // Time it was last taken off the book for good, see closeOrder
+	eventTime   int64  // Time matched
+	stp         string // Self trade prevention mode, used if the order is amended and matched again
+	hidden      bool   // Hidden orders don't show on the book, and fill after the displayed orders at their price (see hidden.go)
+	allOrNone   bool   // Execution constraints, see constraints.go
+	minQty      int
+	reduceOnly  bool   // Can't trade past its owner's position, and is cut down when that shrinks (see flags.go)
+	peg         string // What a pegged order follows, empty if it isn't pegged (see peg.go)
+	pegOffset   int
+	pegCap      int
 	parentLimit *Limit
+
+	clientOrderID string // The owner's own ID for the order, if they gave it one (see client.go)
 }
 
 // Limit holds a doubly linked list of Orders at specified limit price
 type Limit struct {
 	LimitPrice  int      `json:"price"`
-	Size        int      `json:"size"`   // I'm thinking this is length of linked list
-	TotalVolume int      `json:"volume"` // This is sum of shares of linked list
+	Size        int      `json:"size"`   // Number of displayed orders
+	TotalVolume int      `json:"volume"` // Sum of displayed shares
 	orders      []*Order // Switched from Linked List to Slices
+	hidden      []*Order // Hidden orders, which fill after everything in orders
+
+	reserveVolume int // Sum of iceberg reserves at this limit, matchable but not displayed in TotalVolume
+	hiddenVolume  int // Sum of hidden orders' shares
 }
 
 // Order RB-Tree by limitPrice
@@ -65,8 +84,13 @@ type Book struct {
 	highestBuy *Limit
 
 	// TODO: Maybe flush OrderMap to database at end of trade day
-	OrderMap map[int]*Order // Map keyed off orderID -> Order
-	limitMap map[int]*Limit // Map keyed off limitPrice -> Limit
+	OrderMap     map[int]*Order // Map keyed off orderID -> Order
+	closedOrders map[int]*Order // Map keyed off orderID -> Order no longer on the book (filled, cancelled or expired)
+	closing      []closedEntry  // Orders as they were added to closedOrders, oldest first, to be forgotten (see lookup.go)
+	// Maps keyed off limitPrice -> Limit, one per side since both sides can hold the same price while an auction
+	// collects orders (see auction.go)
+	buyLimits  map[int]*Limit
+	sellLimits map[int]*Limit
 
 	// TODO: Maybe move this somewhere
 	marketPrice int // set whenever a market order is satisfied
@@ -74,46 +98,124 @@ type Book struct {
 	//orderQueue []*OrderSchema // Queue of orders for this asset's book
 	OrderQueue chan *OrderSchema // Queue of orders but with a channel
 
-	//mu sync.Mutex // Mutex lock, one per book
+	// Stop orders waiting for marketPrice to reach their stop price (see stops.go)
+	buyStops      *rbtree.Rbtree
+	sellStops     *rbtree.Rbtree
+	trailingStops []*OrderSchema
+
+	// Resting DAY/GTD orders ordered by expiry, and the timer armed for the earliest one (see expiry.go)
+	expiries      expiryQueue
+	expiryTimer   *time.Timer
+	expiryTimerAt int64
+
+	// How incoming shares are shared out among the orders at a price level (see matching.go)
+	policy MatchingPolicy
+
+	// Trading state (see state.go), and the call auction being run if there is one (see auction.go)
+	state         string
+	auctionOrders []*OrderSchema // Market orders waiting for the uncross
+	auctionTimer  *time.Timer
+	auctionEnd    int64
+	auctionInfo   *AuctionInfo
+	stateReason   string // Why the book isn't trading continuously (ReasonCall, ReasonVolatility, ...)
+	haltNote      string // Admin's explanation of a halt
+
+	// Resting pegged orders, and the references they were last priced off (see peg.go)
+	pegged    []*Order
+	pegPrices [4]int
+
+	// Resting reduce-only orders, oldest first (see flags.go)
+	reduceOnly []*Order
+
+	// Circuit breakers, and the price the static band is centred on (see bands.go)
+	priceBands PriceBands
+	staticRef  int
+
+	// The asset's tick size, for prices the book sets itself (see ticks.go)
+	tickSize int
+
+	// Operations on the book other than orders (starting an auction, halting, ...), run by MatchOrders between orders
+	controls chan func()
+
+	// Held by MatchOrders while it changes the book, and by the exported accessors (GetMarketPrice, InOrderTraversal, ...)
+	// while they read it, so HTTP goroutines always see the book between two events, never half way through one.
+	// Everything else, including the exported fields, belongs to the matching goroutine
+	mu sync.RWMutex
 }
 
 // GetMarketPrice returns the current market price of this asset
 func (b *Book) GetMarketPrice() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	return b.marketPrice
 }
 
-// NewBook is a "constructor" for the Book.  Necessary to initialize the order and limit maps
-func NewBook(assetID int) *Book {
+// NewBook is a "constructor" for the Book.  Necessary to initialize the order and limit maps.
+// policy decides how orders at the same price are matched; nil means FIFO
+func NewBook(assetID int, policy MatchingPolicy) *Book {
 	b := new(Book)
 	b.BuyTree = rbtree.New()
 	b.sellTree = rbtree.New()
 	b.OrderMap = make(map[int]*Order)
-	b.limitMap = make(map[int]*Limit)
+	b.closedOrders = make(map[int]*Order)
+	b.buyLimits = make(map[int]*Limit)
+	b.sellLimits = make(map[int]*Limit)
 	b.marketPrice = 0
 	b.assetID = assetID
+	if policy == nil {
+		policy = FIFO{}
+	}
+	b.policy = policy
 	//b.orderQueue = make([]*OrderSchema, 0)
 	// Make a buffered queue for orders, right now with length 30
 	b.OrderQueue = make(chan *OrderSchema, 30)
-	curID = 1
+	b.buyStops = rbtree.New()
+	b.sellStops = rbtree.New()
+	b.trailingStops = make([]*OrderSchema, 0)
+	b.expiries = make(expiryQueue, 0)
+	b.state = StateContinuous
+	b.priceBands = DefaultPriceBands
+	b.tickSize = 1
+	b.controls = make(chan func(), 10)
 	return b
 }
 
-// NewOrder generates a reference to a new Order object and adds it to the book
-func (b *Book) NewOrder(buyOrSell bool, shares int, limit int) *Order {
-	//	b.mu.Lock()
+// NewOrder generates a reference to a new Order object owned by userID and adds it to the book
+func (b *Book) NewOrder(userID int, buyOrSell bool, shares int, limit int) *Order {
+	o := createOrder(b.nextOrderID(), userID, buyOrSell, shares, limit, time.Now().Unix())
+	b.place(o)
+	return o
+}
+
+// createOrder returns a new Order object with orderID received at entryTime, not yet added to any book
+func createOrder(orderID int, userID int, buyOrSell bool, shares int, limit int, entryTime int64) *Order {
 	o := new(Order)
-	curID++
-	o.idNumber = curID
+	o.idNumber = orderID
+	o.userID = userID
 	o.buyOrSell = buyOrSell
 	o.shares = shares
 	o.limit = limit
-	o.entryTime = time.Now().Unix()
-	b.OrderMap[curID] = o
+	o.entryTime = entryTime
+	return o
+}
+
+// place adds order o to the orderMap, then to the book
+func (b *Book) place(o *Order) {
+	//	b.mu.Lock()
+	b.OrderMap[o.idNumber] = o
+	delete(b.closedOrders, o.idNumber)
 
 	// b.mu.Unlock()
 
-	b.Add(curID)
-	return o
+	b.Add(o.idNumber)
+}
+
+// limits returns the map of Limits for the buy (or sell) side of the book
+func (b *Book) limits(buyOrSell bool) map[int]*Limit {
+	if buyOrSell {
+		return b.buyLimits
+	}
+	return b.sellLimits
 }
 
 func newLimit(limit int) *Limit {
@@ -132,29 +234,21 @@ func (b *Book) Add(orderID int) {
 	o := b.OrderMap[orderID]
 
 	// Check if can be O(1)
-	if l, exists := b.limitMap[o.limit]; exists {
+	if l, exists := b.limits(o.buyOrSell)[o.limit]; exists {
 		// Limit already exists, add to end of linked list of orders
-		o.parentLimit = l
-		l.orders = append(l.orders, o)
-
-		// Update limit metadata
-		l.Size = l.Size + 1
-		l.TotalVolume = l.TotalVolume + o.shares
+		l.join(o)
 		return
 	}
 
 	// Limit doesn't exist yet, insert new limit in tree O(log(M))
 	l := newLimit(o.limit)
-	l.Size = 1
-	l.TotalVolume = o.shares
-	l.orders = append(l.orders, o)
-	o.parentLimit = l
+	l.join(o)
 
 	// Is the order a buy or sell?
 	if o.buyOrSell {
 		// Buy
 		// Set highest bid if necessary
-		if b.GetBestBid() == nil || l.LimitPrice > b.GetBestBid().LimitPrice {
+		if b.bestBid() == nil || l.LimitPrice > b.bestBid().LimitPrice {
 			b.highestBuy = l
 		}
 		// Insert limit into RB-Tree
@@ -162,7 +256,7 @@ func (b *Book) Add(orderID int) {
 	} else {
 		// Sell
 		// Set lowest ask if necessary
-		if b.GetBestOffer() == nil || l.LimitPrice < b.GetBestOffer().LimitPrice {
+		if b.bestOffer() == nil || l.LimitPrice < b.bestOffer().LimitPrice {
 			b.lowestSell = l
 		}
 		// Insert limit into RB-Tree
@@ -170,7 +264,7 @@ func (b *Book) Add(orderID int) {
 	}
 
 	// Add limit to map
-	b.limitMap[l.LimitPrice] = l
+	b.limits(o.buyOrSell)[l.LimitPrice] = l
 
 	// Add order to map (COMMENTED BECAUSE SHOULD BE DONE OUTSIDE ADD)
 	// b.orderMap[orderID] = o
@@ -182,18 +276,12 @@ func (b *Book) Cancel(orderID int) {
 	// defer b.mu.Unlock()
 	// Remove order from all structures, limit too if necessary
 	if o, exists := b.OrderMap[orderID]; exists {
-		// Delete order from linked list
+		// Delete order from linked list, updating parent Limit metadata
 		l := o.parentLimit
-		for i := 0; i < l.Size; i++ {
-			if l.orders[i] == o {
-				l.orders = append(l.orders[:i], l.orders[i+1:]...)
-				// Break so as not to have bad access (ex delete first item in list of 2 then access l[1])
-				break
-			}
-		}
+		l.leave(o)
 
 		// Check if parent Limit is now empty
-		if l.Size == 1 {
+		if l.TotalOrders() == 0 {
 			// This was the last order for this limit.  Delete the limit
 			if o.buyOrSell {
 				// Limit in buyTree
@@ -217,15 +305,13 @@ func (b *Book) Cancel(orderID int) {
 				}
 			}
 			// Delete from limit map
-			delete(b.limitMap, l.LimitPrice)
-		} else {
-			// Update parent Limit metadata
-			l.Size = l.Size - 1
-			l.TotalVolume = l.TotalVolume - o.shares
+			delete(b.limits(o.buyOrSell), l.LimitPrice)
 		}
 
 		// Delete the order from orderMap TODO: UNDERSTAND IF THIS IS NECESSARY
 		delete(b.OrderMap, orderID)
+		// Remember it so cancel and status requests can tell what happened to it
+		b.closeOrder(o)
 
 		// Hopefully since Go garbage collects, this order is now gonzo
 	} else {
@@ -235,115 +321,340 @@ func (b *Book) Cancel(orderID int) {
 
 }
 
-// ExecuteMarketBuy is called when a market buy comes in for numShares
-// Returns total cost of transaction
-func (b *Book) ExecuteMarketBuy(numShares int) int {
-	// b.mu.Lock()
-	// defer b.mu.Unlock()
-	transactionSum := 0
+// noLimit is the limit price handed to sweep by market orders, which walk the book at any price.  It's well outside
+// the prices orders can have (they're all positive), so it can't be mistaken for one
+const noLimit = math.MinInt
+
+// crosses reports whether a resting limit at price can be matched by an incoming buy (or sell) with limitPrice
+func crosses(buyOrSell bool, price int, limitPrice int) bool {
+	if limitPrice == noLimit {
+		return true
+	}
+	if buyOrSell {
+		return price <= limitPrice
+	}
+	return price >= limitPrice
+}
+
+// sweep fills numShares for userID against the other side of the book, walking levels from the best price until
+// the order is filled, the book runs dry, or the next level is worse than limitPrice.  The book's MatchingPolicy
+// decides which resting orders at each level get filled, and by how much.
+// Resting orders owned by the taker are never traded with, see preventSelfTrade.
+// Reaching a level outside the price bands trips the circuit breaker instead, see bands.go.
+// Fills and self trade events are recorded in r.
+// Returns the number of shares left unfilled, and whether self trade prevention cancelled them
+func (b *Book) sweep(t taker, numShares int, limitPrice int, r *ExecutionReport) (int, bool) {
+	fills := make([]Fill, 0)
+	defer func() { r.addFills(fills) }()
+
+	buyOrSell := t.buyOrSell
+	ledger := users.GetLedger()
+	// The bands are fixed for the whole sweep, so an order can't walk the price away a level at a time
+	lo, hi := b.bands()
+	spent := 0
 	for numShares > 0 {
-		// Get best offer
-		bestLim := b.GetBestOffer()
-		// No More bids in the book?
+		// Get best price on the other side of the book with orders we can trade with (see constraints.go)
+		bestLim, allocations := b.nextMatch(buyOrSell, limitPrice, numShares)
+		// No more liquidity in the book, or the best level is past our limit?
 		if bestLim == nil {
-			return transactionSum
+			break
+		}
+		if !inBands(bestLim.LimitPrice, lo, hi) {
+			b.tripCircuitBreaker(bestLim.LimitPrice, lo, hi)
+			break
+		}
+		if t.cash > 0 {
+			// A notional buy only takes as many whole shares as the cash it has left covers
+			if affordable := (t.cash - spent) / bestLim.LimitPrice; affordable < numShares {
+				allocations = b.allocateLevel(bestLim, affordable)
+				if len(allocations) == 0 {
+					break
+				}
+			}
 		}
 
-		oldestOrder := bestLim.orders[0]
+		for _, a := range allocations {
+			resting, fillQty := a.order, a.qty
 
-		if oldestOrder.shares > numShares {
-			// Just the oldest order is enough to fulfill market buy
-			b.marketPrice = bestLim.LimitPrice
-			oldestOrder.shares -= numShares
-			bestLim.TotalVolume -= numShares
+			if resting.reduceOnly && fillQty > b.reducible(resting.userID, resting.buyOrSell) {
+				// Its owner's position moved since it rested, cut it down and allocate the level again
+				b.trimReduceOnly(resting.userID)
+				break
+			}
+			if resting.userID == t.userID {
+				decremented, stop := b.preventSelfTrade(t, resting, numShares, r)
+				numShares -= decremented
+				if stop {
+					return numShares, true
+				}
+				// The level changed under the allocation, allocate it again
+				break
+			}
 
-			// Record in ledger
-			ledger := users.GetLedger()
-			ledger.RecordTrade(b.assetID, numShares, bestLim.LimitPrice, 2, 1)
+			// Record in ledger; the incoming order is the taker, the resting order's owner is the maker
+			buyerID, sellerID := t.userID, resting.userID
+			if !buyOrSell {
+				buyerID, sellerID = resting.userID, t.userID
+			}
+			// Only execute the trade if its OK with the ledger; i.e buyer doesn't have enough funds, seller doesn't have enough of the asset
+			if !ledger.RecordTrade(b.assetID, fillQty, bestLim.LimitPrice, buyerID, sellerID) {
+				return numShares, false
+			}
 
-			return transactionSum + (numShares * bestLim.LimitPrice)
-		} else {
-			// This order will totally fill the oldest
-			// TODO: keep track of what orders were filled to fulfill later
 			b.marketPrice = bestLim.LimitPrice
-			numShares = numShares - oldestOrder.shares
-			transactionSum += oldestOrder.shares * oldestOrder.limit
-			b.Cancel(oldestOrder.idNumber)
+			if b.staticRef == 0 {
+				b.staticRef = bestLim.LimitPrice
+			}
+			numShares -= fillQty
+			spent += fillQty * bestLim.LimitPrice
+			fills = append(fills, Fill{bestLim.LimitPrice, fillQty, resting.idNumber})
+			b.fillResting(resting, fillQty)
+
+			// The trade moved both positions, which resting reduce-only orders can't trade past
+			trimmedBuyer := b.trimReduceOnly(buyerID)
+			if trimmed := b.trimReduceOnly(sellerID); trimmed || trimmedBuyer {
+				break
+			}
+		}
+	}
+
+	return numShares, false
+}
 
+// fillResting takes qty filled shares off resting order o.  Fills bigger than an iceberg's displayed slice run into
+// its reserve, one slice at a time
+func (b *Book) fillResting(o *Order, qty int) {
+	o.filled += qty
+	for qty > 0 {
+		l := o.parentLimit
+		fillQty := qty
+		if o.shares < fillQty {
+			fillQty = o.shares
+		}
+		qty -= fillQty
+
+		if fillQty == o.shares && o.reserve > 0 {
+			// This fills the resting order's visible slice, but it's an iceberg with more in reserve
+			l.take(o, fillQty)
+			b.replenish(o)
+		} else if fillQty == o.shares {
+			// This totally fills the resting order, remove it
+			// TODO: alert the owners of filled orders
+			b.Cancel(o.idNumber)
+			o.shares = 0
+			return
+		} else {
+			o.shares -= fillQty
+			l.take(o, fillQty)
 		}
 	}
-	return transactionSum
 }
 
-// ExecuteMarketSell is called when a market sell comes in for numShares
+// ExecuteMarketBuy is called when a market buy comes in for numShares from the user with userID
 // Returns total cost of transaction
-func (b *Book) ExecuteMarketSell(numShares int) int {
-	// b.mu.Lock()
-	// defer b.mu.Unlock()
-	// Get best offer
-	transactionSum := 0
-	for numShares > 0 {
-		bestLim := b.GetBestBid()
-		// No More bids in the book?
-		if bestLim == nil {
-			return transactionSum
+func (b *Book) ExecuteMarketBuy(userID int, numShares int) int {
+	r := newReport(0)
+	b.sweep(taker{0, userID, true, selfTradeMode("", userID), 0}, numShares, noLimit, r)
+	return r.TotalCost()
+}
+
+// ExecuteMarketSell is called when a market sell comes in for numShares from the user with userID
+// Returns total cost of transaction
+func (b *Book) ExecuteMarketSell(userID int, numShares int) int {
+	r := newReport(0)
+	b.sweep(taker{0, userID, false, selfTradeMode("", userID), 0}, numShares, noLimit, r)
+	return r.TotalCost()
+}
+
+// availableVolume returns how many shares on the other side of the book an incoming buy (or sell) with limitPrice
+// could match right now, counting levels from the best price and stopping early once upTo shares are found
+func (b *Book) availableVolume(buyOrSell bool, limitPrice int, upTo int) int {
+	volume := 0
+	count := func(item rbtree.Item) bool {
+		l := item.(*Limit)
+		if !crosses(buyOrSell, l.LimitPrice, limitPrice) {
+			return false
 		}
+		volume += l.TotalLiquidity()
+		return volume < upTo
+	}
 
-		oldestOrder := bestLim.orders[0]
+	if buyOrSell {
+		if best := b.bestOffer(); best != nil {
+			b.sellTree.Ascend(best, count)
+		}
+	} else {
+		if best := b.bestBid(); best != nil {
+			b.BuyTree.Descend(best, count)
+		}
+	}
+	return volume
+}
 
-		if oldestOrder.shares > numShares {
-			// Record in ledger
-			ledger := users.GetLedger()
-			// Only execute the trade if its OK with the ledger; i.e buyer doesn't have enough funds, seller doesn't have enough of the asset
-			if ledger.RecordTrade(b.assetID, numShares, bestLim.LimitPrice, 3, 1) {
-				// The current limit order is enough to fulfill market buy; Fill, Record in Ledger, alert participants.
-				b.marketPrice = bestLim.LimitPrice
-				oldestOrder.shares -= numShares
-				bestLim.TotalVolume -= numShares
-			}
+// ExecuteOrder matches an incoming market or limit order according to its time in force.
+// A limit order is matched against every level at or better than its limit price, and whatever is left
+// rests on the book with the order's original entry time (unless it is IOC/FOK), expiring if it is DAY/GTD.
+// Market orders never rest.
+// Returns the order's execution report
+func (b *Book) ExecuteOrder(o *OrderSchema) *ExecutionReport {
+	buyOrSell := o.Side == "buy"
+	limitPrice := o.LimitPrice
+	if o.OrderType != "limit" {
+		// Market orders stop at their protection price, if they have one (see protection.go)
+		limitPrice = b.protectionLimit(o)
+	}
 
-			return transactionSum + (numShares * bestLim.LimitPrice)
-		} else {
-			// This order will totally fill the oldest, and start filling the next order.
-			// Fill this order, record it in the ledger, alert the owner of the order
-			b.marketPrice = bestLim.LimitPrice
-			numShares = numShares - oldestOrder.shares
-			transactionSum += oldestOrder.shares * oldestOrder.limit
-			b.Cancel(oldestOrder.idNumber)
+	if o.ReduceOnly {
+		if reason := b.checkReduceOnly(o); reason != "" {
+			return rejection(o, reason)
 		}
 	}
+	if o.Peg != "" {
+		return b.restPegged(o)
+	}
+	if o.OrderType == "limit" && o.LimitPrice <= 0 {
+		// e.g. a trailing stop limit sell whose limit offset took it below 0
+		return rejection(o, "limit price must be greater than 0")
+	}
+	if o.Notional > 0 {
+		return b.executeNotional(o)
+	}
+	if o.PostOnly && o.OrderType == "limit" {
+		// Post only orders never match, they rest on the book or don't trade at all
+		if reason := b.checkPostOnly(o); reason != "" {
+			return rejection(o, reason)
+		}
+		b.rest(o, buyOrSell, o.Qty)
+		r := newReport(o.OrderID)
+		r.settle(o.Qty, o.Qty)
+		return r
+	}
+
+	r := newReport(o.OrderID)
+	o.SelfTradePrevention = selfTradeMode(o.SelfTradePrevention, o.UserID)
+	t := taker{o.OrderID, o.UserID, buyOrSell, o.SelfTradePrevention, 0}
+	// Fill or kill, all or none and min qty: make sure the minimum is there before touching the book
+	if need := o.minFill(); need > 0 && b.fillable(t, b.bandLimit(buyOrSell, limitPrice), need) < need {
+		if o.OrderType == "limit" && o.rests() {
+			// Wait on the book for an order that can meet it
+			b.rest(o, buyOrSell, o.Qty)
+			r.settle(o.Qty, o.Qty)
+			return r
+		}
+		r.settle(o.Qty, 0)
+		return r
+	}
 
-	return transactionSum
+	remaining, stopped := b.sweep(t, o.Qty, limitPrice, r)
+	if remaining > 0 && !stopped {
+		// A market to limit order becomes a limit order at its last fill price, so the rest of it can wait on the book
+		marketToLimit(o, r)
+	}
+	if remaining > 0 && !stopped && b.state == StateAuction && o.rests() {
+		// The order tripped the circuit breaker, what's left of it waits for the volatility auction
+		b.holdForAuction(o, remaining)
+		r.OrderID = o.OrderID
+	} else if remaining > 0 && !stopped && o.OrderType == "limit" && o.rests() {
+		b.rest(o, buyOrSell, remaining)
+		r.OrderID = o.OrderID
+	} else {
+		remaining = 0
+	}
+	r.settle(o.Qty, remaining)
+	return r
+}
+
+// rest adds the unfilled shares of limit order o to the book, keeping the time the order was received
+func (b *Book) rest(o *OrderSchema, buyOrSell bool, shares int) {
+	if o.OrderID == 0 {
+		// Didn't come through EnqueueOrder
+		o.OrderID = b.nextOrderID()
+	}
+	resting := createOrder(o.OrderID, o.UserID, buyOrSell, shares, o.LimitPrice, o.EntryTime)
+	resting.filled = o.Qty - shares
+	resting.setDisplay(o.DisplayQty)
+	resting.stp = o.SelfTradePrevention
+	resting.hidden = o.Hidden
+	resting.allOrNone, resting.minQty = o.AllOrNone, o.MinQty
+	resting.clientOrderID = o.ClientOrderID
+	b.place(resting)
+	if o.ReduceOnly {
+		resting.reduceOnly = true
+		b.reduceOnly = append(b.reduceOnly, resting)
+	}
+	if o.Peg != "" {
+		resting.peg, resting.pegOffset, resting.pegCap = o.Peg, o.PegOffset, o.PegCap
+		b.pegged = append(b.pegged, resting)
+	}
+	b.scheduleExpiry(resting, o.expiresAt())
 }
 
-// GetVolumeAtLimit returns the total volume of orders at that limit price
+// GetVolumeAtLimit returns the total volume of orders at that limit price, on both sides of the book
 func (b *Book) GetVolumeAtLimit(limit int) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	volume := 0
 	// Get volume at limit price if it exists
-	if l, exists := b.limitMap[limit]; exists {
-		return l.TotalVolume
+	if l, exists := b.buyLimits[limit]; exists {
+		volume += l.TotalVolume
 	}
-	return 0
+	if l, exists := b.sellLimits[limit]; exists {
+		volume += l.TotalVolume
+	}
+	return volume
 }
 
-// GetBestBid returns price of highest buy limit
+// GetBestBid returns a copy of the highest buy limit, nil if there are no bids
 func (b *Book) GetBestBid() *Limit {
-	if b.highestBuy != nil {
-		return b.highestBuy
-	}
-	return nil
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return snapshot(b.bestBid())
 }
 
-// GetBestOffer returns price of lowest sell limit
+// bestBid returns the highest buy limit itself, for use on the matching goroutine
+func (b *Book) bestBid() *Limit {
+	return b.highestBuy
+}
+
+// GetBestOffer returns a copy of the lowest sell limit, nil if there are no offers
 func (b *Book) GetBestOffer() *Limit {
-	if b.lowestSell != nil {
-		return b.lowestSell
-	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return snapshot(b.bestOffer())
+}
 
-	return nil
+// bestOffer returns the lowest sell limit itself, for use on the matching goroutine
+func (b *Book) bestOffer() *Limit {
+	return b.lowestSell
+}
+
+// snapshot returns a copy of l that's safe to read once the book is unlocked, or nil if l is nil.  The copy's orders
+// are the book's, don't touch them
+func snapshot(l *Limit) *Limit {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	return &c
 }
 
 // EnqueueOrder pushes an order to the queue to be executed later
 func (b *Book) EnqueueOrder(order *OrderSchema) {
+	// Stamp the time the order was received, so any part of it that rests keeps its place in time
+	if order.EntryTime == 0 {
+		order.EntryTime = time.Now().Unix()
+	}
+	// New orders get their ID now, so it can be handed back before they're matched
+	if order.Action == ActionNew && order.OrderID == 0 {
+		if order.ClientOrderID == "" {
+			order.OrderID = b.nextOrderID()
+		} else if original := b.claimClientOrderID(order); original != nil {
+			// Resubmission of an order its owner already sent (see client.go), answer with the original's report
+			order.OrderID = original.orderID
+			go original.resend(order)
+			return
+		}
+	}
 	//mu.Lock()
 	//b.orderQueue = append(b.orderQueue, order)
 	b.OrderQueue <- order
@@ -353,83 +664,135 @@ func (b *Book) EnqueueOrder(order *OrderSchema) {
 // MatchOrders will be running constantly as a goroutine alongside the http listener.  This pops orders from the queue one by one, matching them appropriately.
 func (b *Book) MatchOrders() {
 	for {
-		//mu.Lock()
-		o := <-b.OrderQueue
+		var o *OrderSchema
+		select {
+		case o = <-b.OrderQueue:
+		case <-b.expiryC():
+			// Cancel any DAY/GTD orders that are due, then go back to waiting
+			b.mu.Lock()
+			b.expireOrders(time.Now().Unix())
+			b.repeg()
+			b.mu.Unlock()
+			continue
+		case <-b.auctionC():
+			b.mu.Lock()
+			b.uncross()
+			b.mu.Unlock()
+			continue
+		case f := <-b.controls:
+			b.mu.Lock()
+			f()
+			b.mu.Unlock()
+			continue
+		}
 		//if len(b.orderQueue) > 0 {
 		start := time.Now()
 		// Pop order
 		//	o := b.orderQueue[0]
 		//	b.orderQueue = b.orderQueue[1:]
 
-		if o.OrderType == "market" {
-			// Market Order, simply match
-			if o.Side == "buy" {
-				fmt.Printf("Bought %d worth of %s!", b.ExecuteMarketBuy(o.Qty), o.Symbol)
-			} else {
-				fmt.Printf("Sold %d worth of %s!", b.ExecuteMarketSell(o.Qty), o.Symbol)
-				//b.ExecuteMarketSell(o.Qty)
-			}
-		} else if o.OrderType == "limit" {
-			// Limit Order, add to book
-			// TODO: Consider cases which consitute instant matching (limit buy too high)
-			if o.Side == "buy" {
-				if b.GetBestOffer() == nil || o.LimitPrice < b.GetBestOffer().LimitPrice {
-					b.NewOrder(true, o.Qty, o.LimitPrice)
-				} else {
-					// Limit Price higher than lowest limit sell; execute immediately
-					fmt.Printf("Bought %d worth of %s!", b.ExecuteMarketBuy(o.Qty), o.Symbol)
-				}
-			} else {
-				if b.GetBestBid() == nil || o.LimitPrice > b.GetBestBid().LimitPrice {
-					b.NewOrder(false, o.Qty, o.LimitPrice)
-				} else {
-					// Limit Price lower than highest limit buy; execute immediately
-					fmt.Printf("Sold %d worth of %s!", b.ExecuteMarketSell(o.Qty), o.Symbol)
-				}
-			}
-			//b.InOrderTraversal()
-		}
+		b.mu.Lock()
+		b.processOrder(o)
+		b.mu.Unlock()
+		//b.InOrderTraversal()
 		elapsed := time.Since(start)
 		log.Printf("Order operation took %s", elapsed)
 		//	}
-		//mu.Unlock()
 	}
 }
 
-var bids []Limit
-var asks []Limit
+// processOrder matches (or holds, for stops) a single order, or applies an amendment or cancel, off the queue, then releases any
+// stops its trades triggered and reprices pegged orders if it moved the best bid or offer
+func (b *Book) processOrder(o *OrderSchema) {
+	b.forgetClosed(time.Now().Unix())
+	if b.rejectHalted(o) {
+		return
+	}
+	if o.Action == ActionCancel {
+		o.report(b.cancel(o))
+	} else if o.Action == ActionAmend {
+		// Amendment to a resting order, may trade if its new price crosses the spread
+		o.report(b.amend(o))
+	} else if o.isTrailingStop() {
+		// Trailing stops start trailing from the current market price
+		b.trailingStops = append(b.trailingStops, o)
+		b.scheduleStopExpiry(o)
+		o.report(b.heldStop(o))
+	} else if o.isStop() {
+		// Stops wait in the trigger trees, unless the market is already through the stop price
+		b.addStop(o)
+		b.scheduleStopExpiry(o)
+		o.report(b.heldStop(o))
+	} else {
+		b.matchOrder(o)
+	}
+	b.releaseStops()
+	b.repeg()
+
+	if b.state == StateAuction {
+		b.publishAuctionInfo()
+	}
+}
+
+// releaseStops matches each stop the market price has moved through, before the next order is taken off the queue
+func (b *Book) releaseStops() {
+	b.updateTrailingStops()
+	for stop := b.nextTriggeredStop(); stop != nil; stop = b.nextTriggeredStop() {
+		fmt.Printf("Stop triggered at %d!", stop.StopPrice)
+		b.matchOrder(stop)
+		b.updateTrailingStops()
+	}
+}
+
+// matchOrder executes a market or limit order and reports the result
+func (b *Book) matchOrder(o *OrderSchema) {
+	var r *ExecutionReport
+	if b.state == StateAuction {
+		// Nothing matches until the uncross
+		r = b.collect(o)
+	} else {
+		// Market orders simply match; limit orders fill whatever crosses the spread up to the limit price and add the rest to book
+		r = b.ExecuteOrder(o)
+		if _, resting := b.OrderMap[o.OrderID]; !resting && o.OrderID != 0 && r.Status != StatusRejected && r.RemainingQty == 0 {
+			b.retire(o, r)
+		}
+	}
+	fmt.Printf("%s %s\n", o.Symbol, r)
+	o.report(r)
+}
 
-// InOrderTraversal prints the contents of each limit tree, in order, and returns slices of those limits
+// InOrderTraversal returns copies of the limits on each side of the book, in order, as of a single point in time.
+// Only displayed orders count toward each Limit's Size and TotalVolume, and levels with nothing displayed are left out;
+// TotalOrders and TotalLiquidity of the copies still count everything
 func (b *Book) InOrderTraversal() ([]Limit, []Limit) {
-	bids = make([]Limit, 0)
-	asks = make([]Limit, 0)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 
+	bids := make([]Limit, 0)
+	asks := make([]Limit, 0)
 	//fmt.Printf("Bid Limits: \n")
 	// traverse(b.BuyTree)
-	b.BuyTree.Ascend(b.BuyTree.Min(), printBuys)
+	b.BuyTree.Ascend(b.BuyTree.Min(), collectLimits(&bids))
 	//fmt.Printf("Ask Limits: \n")
 	// traverse(b.sellTree)
-	b.sellTree.Ascend(b.sellTree.Min(), printSells)
+	b.sellTree.Ascend(b.sellTree.Min(), collectLimits(&asks))
 
 	return bids, asks
 }
 
-func printBuys(item rbtree.Item) bool {
-	i, ok := item.(*Limit)
-	if !ok {
-		return false
-	}
-	bids = append(bids, *i)
-	//fmt.Printf("Price: %d    Orders: %d    Volume: %d\n", i.LimitPrice, i.Size, i.TotalVolume)
-	return true
-}
-
-func printSells(item rbtree.Item) bool {
-	i, ok := item.(*Limit)
-	if !ok {
-		return false
+// collectLimits returns a tree iterator that appends a copy of each limit with displayed orders to limits
+func collectLimits(limits *[]Limit) rbtree.Iterator {
+	return func(item rbtree.Item) bool {
+		i, ok := item.(*Limit)
+		if !ok {
+			return false
+		}
+		// Levels with only hidden orders don't show
+		if i.Size == 0 {
+			return true
+		}
+		*limits = append(*limits, *i)
+		//fmt.Printf("Price: %d    Orders: %d    Volume: %d\n", i.LimitPrice, i.Size, i.TotalVolume)
+		return true
 	}
-	asks = append(asks, *i)
-	//fmt.Printf("Price: %d    Orders: %d    Volume: %d\n", i.LimitPrice, i.Size, i.TotalVolume)
-	return true
 }
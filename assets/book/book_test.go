@@ -0,0 +1,413 @@
+package book
+
+import (
+	"exchange/users"
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAssets hands out asset IDs, so each test's book starts with nobody holding any of its asset
+var testAssets = 100
+
+// startBook returns a book for an asset of its own, matching on its own goroutine the way it does behind the API.  It
+// has no price bands, unless the test sets some
+func startBook(policy MatchingPolicy) *Book {
+	if users.GetLedger() == nil {
+		users.Initialize()
+	}
+	testAssets++
+	b := NewBook(testAssets, policy)
+	b.SetPriceBands(PriceBands{})
+	go b.MatchOrders()
+	flush(b)
+	return b
+}
+
+// flush waits until b has run everything already sent down its controls (SetPriceBands, StartAuction, Halt...), which
+// would otherwise race the orders sent after them
+func flush(b *Book) {
+	done := make(chan struct{})
+	b.controls <- func() { close(done) }
+	<-done
+}
+
+// send queues o on b, the way the API does, and waits for its execution report
+func send(b *Book, o *OrderSchema) *ExecutionReport {
+	reply := make(chan *ExecutionReport, 1)
+	o.Reply = reply
+	b.EnqueueOrder(o)
+	return <-reply
+}
+
+// trade moves b's market price to price with a one share trade between users 19 and 20, who tests leave out of
+// everything else.  Nothing can be resting on b at a better price than price
+func trade(b *Book, price int) {
+	send(b, &OrderSchema{UserID: 19, Side: "sell", OrderType: "limit", Qty: 1, LimitPrice: price})
+	send(b, &OrderSchema{UserID: 20, Side: "buy", OrderType: "limit", Qty: 1, LimitPrice: price})
+}
+
+// waitFor fails t if cond doesn't hold within a second, for things the book does off its own timers
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// position returns how many shares of b's asset userID holds, negative if they're short
+func position(b *Book, userID int) int {
+	return users.GetLedger().GetUser(userID).GetSharesOwned(b.assetID)
+}
+
+// Run with -race: readers hammer the book's accessors from their own goroutines (like the HTTP handlers do) while
+// MatchOrders works through a stream of crossing orders, and every snapshot they get has to be a book that makes sense
+func TestConcurrentSnapshots(t *testing.T) {
+	if users.GetLedger() == nil {
+		users.Initialize()
+	}
+	b := NewBook(1, nil)
+	b.SetPriceBands(PriceBands{})
+	go b.MatchOrders()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				bids, asks := b.InOrderTraversal()
+				for _, side := range [][]Limit{bids, asks} {
+					for j, l := range side {
+						if l.Size <= 0 || l.TotalVolume < l.Size {
+							t.Errorf("limit at %d has %d orders for %d shares", l.LimitPrice, l.Size, l.TotalVolume)
+						}
+						if j > 0 && side[j-1].LimitPrice >= l.LimitPrice {
+							t.Errorf("limits out of order: %d then %d", side[j-1].LimitPrice, l.LimitPrice)
+						}
+					}
+				}
+				if len(bids) > 0 && len(asks) > 0 && bids[len(bids)-1].LimitPrice >= asks[0].LimitPrice {
+					t.Errorf("book crossed: bid %d, offer %d", bids[len(bids)-1].LimitPrice, asks[0].LimitPrice)
+				}
+
+				b.GetMarketPrice()
+				b.GetBestBid()
+				b.GetBestOffer()
+				b.GetVolumeAtLimit(50)
+				b.GetStatus()
+				b.GetAuctionInfo()
+				// Let the matching goroutine in, even on a single CPU
+				runtime.Gosched()
+			}
+		}()
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		o := &OrderSchema{UserID: 1 + rng.Intn(20), Qty: 1 + rng.Intn(20), OrderType: "limit", Side: "buy", LimitPrice: 40 + rng.Intn(20)}
+		if rng.Intn(2) == 0 {
+			o.Side = "sell"
+		}
+		if rng.Intn(5) == 0 {
+			o.OrderType = "market"
+		}
+		reply := make(chan *ExecutionReport, 1)
+		o.Reply = reply
+		b.EnqueueOrder(o)
+		<-reply
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+// Run with -race: several goroutines send orders to two books at once, both of them trading (and so settling in the
+// shared ledger), and every order has to get an ID of its own that leads back to the book it was sent to
+func TestConcurrentOrderIDs(t *testing.T) {
+	if users.GetLedger() == nil {
+		users.Initialize()
+	}
+	books := []*Book{NewBook(1, nil), NewBook(2, nil)}
+	for _, b := range books {
+		b.SetPriceBands(PriceBands{})
+		go b.MatchOrders()
+	}
+
+	var wg sync.WaitGroup
+	ids := make([][]int, 4)
+	for w := range ids {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			to := books[w%2]
+			for i := 0; i < 500; i++ {
+				o := &OrderSchema{UserID: 1 + rng.Intn(20), Qty: 1 + rng.Intn(20), OrderType: "limit", Side: "buy", LimitPrice: 40 + rng.Intn(20)}
+				if rng.Intn(2) == 0 {
+					o.Side = "sell"
+				}
+				if rng.Intn(5) == 0 {
+					o.OrderType = "market"
+				}
+				// Reduce only orders read positions the other book's trades are changing
+				o.ReduceOnly = rng.Intn(10) == 0
+				reply := make(chan *ExecutionReport, 1)
+				o.Reply = reply
+				to.EnqueueOrder(o)
+				// Rejected orders (reduce only, with nothing to reduce) aren't kept
+				if r := <-reply; r.Status != StatusRejected && FindOrder(o.OrderID) != to {
+					t.Errorf("order %d not found on the book it was sent to", o.OrderID)
+				}
+				ids[w] = append(ids[w], o.OrderID)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for _, list := range ids {
+		for _, id := range list {
+			if seen[id] {
+				t.Errorf("order ID %d handed out twice", id)
+			}
+			seen[id] = true
+		}
+	}
+	for _, b := range books {
+		if b.GetMarketPrice() == 0 {
+			t.Errorf("book %d never traded", b.GetAssetID())
+		}
+	}
+}
+
+// checkAllocated fails t unless allocations give orders numbered 1 on, in time priority, the shares in want
+func checkAllocated(t *testing.T, name string, allocations []Allocation, want []int) {
+	t.Helper()
+	got := make([]int, len(want))
+	for _, a := range allocations {
+		if a.qty <= 0 {
+			t.Errorf("%s: allocated %d shares to order %d", name, a.qty, a.order.idNumber)
+		}
+		got[a.order.idNumber-1] += a.qty
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+// Pro-rata shares come from rounding down, with the leftovers going to the biggest orders that have room, oldest first
+func TestProRata(t *testing.T) {
+	tests := []struct {
+		name   string
+		shares []int
+		qty    int
+		want   []int // Shares each order gets, in time priority
+	}{
+		{"even split", []int{10, 10}, 10, []int{5, 5}},
+		{"exact proportions", []int{3, 3, 4}, 10, []int{3, 3, 4}},
+		{"round down", []int{2, 4, 4}, 5, []int{1, 2, 2}},
+		{"leftover to oldest of equals", []int{3, 3, 3}, 4, []int{2, 1, 1}},
+		{"leftovers one at a time", []int{1, 1, 1}, 2, []int{1, 1, 0}},
+		{"leftover to biggest", []int{1, 10}, 7, []int{0, 7}},
+		{"biggest first, then oldest", []int{2, 1, 1}, 3, []int{2, 1, 0}},
+		{"more than the level", []int{3, 3, 3}, 100, []int{3, 3, 3}},
+		{"nothing", []int{3, 3}, 0, []int{0, 0}},
+	}
+	for _, tt := range tests {
+		orders := make([]*Order, len(tt.shares))
+		for i, s := range tt.shares {
+			orders[i] = &Order{idNumber: i + 1, shares: s}
+		}
+		checkAllocated(t, tt.name, proRata(orders, tt.qty), tt.want)
+	}
+}
+
+// Each policy shares a market order out among the same level the way it says it does
+func TestMatchingPolicy(t *testing.T) {
+	tests := []struct {
+		policy MatchingPolicy
+		want   []int // Shares each resting order sells, in time priority
+	}{
+		{FIFO{}, []int{2, 3, 0}},
+		{ProRata{}, []int{1, 2, 2}},
+		{TopOrderProRata{}, []int{2, 2, 1}},
+	}
+	for _, tt := range tests {
+		b := startBook(tt.policy)
+		resting := make(map[int]int)
+		for i, qty := range []int{2, 4, 4} {
+			o := &OrderSchema{UserID: i + 1, Side: "sell", OrderType: "limit", Qty: qty, LimitPrice: 50}
+			send(b, o)
+			resting[o.OrderID] = i
+		}
+		r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 5})
+		got := make([]int, len(tt.want))
+		for _, f := range r.Fills {
+			got[resting[f.CounterParty]] += f.Qty
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%T: resting orders sold %v, want %v", tt.policy, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// The clearing price executes the most shares, then leaves the smallest imbalance, then is nearest the last trade,
+// then is the lowest
+func TestClearing(t *testing.T) {
+	type level struct {
+		buyOrSell bool
+		shares    int
+		price     int
+	}
+	tests := []struct {
+		name        string
+		levels      []level
+		market      []OrderSchema // Market orders collected by the auction
+		marketPrice int
+		price       int
+		volume      int
+		imbalance   int
+	}{
+		{"most volume", []level{{true, 10, 52}, {true, 10, 50}, {false, 5, 49}, {false, 10, 51}}, nil, 0, 51, 10, -5},
+		{"nearest the last trade", []level{{true, 10, 52}, {true, 10, 50}, {false, 5, 49}, {false, 10, 51}}, nil, 53, 52, 10, -5},
+		{"smallest imbalance", []level{{true, 10, 51}, {true, 5, 50}, {false, 10, 50}}, nil, 0, 51, 10, 0},
+		{"lowest", []level{{true, 10, 52}, {false, 10, 50}}, nil, 0, 50, 10, 0},
+		{"market orders at the last trade", nil, []OrderSchema{{Side: "buy", Qty: 5}, {Side: "sell", Qty: 8}}, 40, 40, 5, -3},
+		{"market orders against limits", []level{{false, 10, 45}}, []OrderSchema{{Side: "buy", Qty: 4}}, 0, 45, 4, -6},
+		{"nothing crosses", []level{{true, 10, 49}, {false, 10, 50}}, nil, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		b := NewBook(1, nil)
+		b.marketPrice = tt.marketPrice
+		for _, l := range tt.levels {
+			b.NewOrder(1, l.buyOrSell, l.shares, l.price)
+		}
+		for i := range tt.market {
+			b.auctionOrders = append(b.auctionOrders, &tt.market[i])
+		}
+		price, volume, imbalance := b.clearing()
+		if price != tt.price || volume != tt.volume || imbalance != tt.imbalance {
+			t.Errorf("%s: got %d shares at %d (imbalance %d), want %d at %d (imbalance %d)",
+				tt.name, volume, price, imbalance, tt.volume, tt.price, tt.imbalance)
+		}
+	}
+}
+
+func TestBetterClearing(t *testing.T) {
+	tests := []struct {
+		name                                 string
+		marketPrice                          int
+		price, volume, imbalance             int
+		bestPrice, bestVolume, bestImbalance int
+		want                                 bool
+	}{
+		{"more volume", 0, 50, 10, 5, 51, 9, 0, true},
+		{"less volume", 0, 50, 9, 0, 51, 10, 5, false},
+		{"smaller imbalance", 0, 50, 10, -2, 51, 10, 3, true},
+		{"bigger imbalance", 0, 50, 10, 5, 51, 10, 0, false},
+		{"nearer the last trade", 52, 51, 10, 0, 50, 10, 0, true},
+		{"further from the last trade", 52, 50, 10, 0, 51, 10, 0, false},
+		{"lower", 0, 50, 10, 0, 51, 10, 0, true},
+		{"higher", 0, 51, 10, 0, 50, 10, 0, false},
+		{"equally near, lower", 50, 49, 10, 0, 51, 10, 0, true},
+	}
+	for _, tt := range tests {
+		b := NewBook(1, nil)
+		b.marketPrice = tt.marketPrice
+		if got := b.betterClearing(tt.price, tt.volume, tt.imbalance, tt.bestPrice, tt.bestVolume, tt.bestImbalance); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Resting orders with a constraint only get a fill that meets it; anyone the policy shorts drops out, and the level is
+// shared again without them
+func TestAllocate(t *testing.T) {
+	type resting struct {
+		shares    int
+		allOrNone bool
+		minQty    int
+	}
+	tests := []struct {
+		name   string
+		policy MatchingPolicy
+		orders []resting
+		qty    int
+		want   []int // Shares each order gets, in time priority
+	}{
+		{"all or none skipped", FIFO{}, []resting{{5, true, 0}, {5, false, 0}}, 3, []int{0, 3}},
+		{"all or none filled", FIFO{}, []resting{{5, true, 0}, {5, false, 0}}, 7, []int{5, 2}},
+		{"min qty skipped", FIFO{}, []resting{{10, false, 4}, {10, false, 0}}, 3, []int{0, 3}},
+		{"min qty met", FIFO{}, []resting{{10, false, 4}, {10, false, 0}}, 6, []int{6, 0}},
+		{"min qty over what's left", FIFO{}, []resting{{3, false, 5}}, 3, []int{3}},
+		{"nobody can take it", FIFO{}, []resting{{5, true, 0}, {10, false, 6}}, 4, []int{0, 0}},
+		{"pro-rata drops all or none", ProRata{}, []resting{{10, true, 0}, {10, false, 0}}, 12, []int{0, 10}},
+		{"pro-rata drops short min qty", ProRata{}, []resting{{10, false, 5}, {10, false, 0}}, 8, []int{0, 8}},
+		{"pro-rata keeps met min qty", ProRata{}, []resting{{10, false, 5}, {10, false, 0}}, 12, []int{6, 6}},
+		{"pro-rata drop-out cascades", ProRata{}, []resting{{10, false, 4}, {10, false, 6}, {10, false, 0}}, 12, []int{6, 0, 6}},
+	}
+	for _, tt := range tests {
+		l := &Limit{LimitPrice: 50}
+		orders := make([]*Order, len(tt.orders))
+		for i, r := range tt.orders {
+			orders[i] = &Order{idNumber: i + 1, shares: r.shares, limit: 50, allOrNone: r.allOrNone, minQty: r.minQty}
+		}
+		checkAllocated(t, tt.name, allocate(tt.policy, l, orders, tt.qty), tt.want)
+	}
+}
+
+// An incoming order with a constraint trades only if the book can meet it right away, and incoming orders skip resting
+// ones they can't meet
+func TestExecutionConstraints(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   OrderSchema
+		filled  int
+		resting int
+	}{
+		{"all or none can't fill", OrderSchema{OrderType: "market", Qty: 10, AllOrNone: true}, 0, 0},
+		{"min qty across levels", OrderSchema{OrderType: "market", Qty: 10, MinQty: 5}, 6, 0},
+		{"min qty can't fill", OrderSchema{OrderType: "market", Qty: 10, MinQty: 7}, 0, 0},
+		{"all or none limit rests whole", OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 51, AllOrNone: true}, 0, 10},
+	}
+	for _, tt := range tests {
+		b := startBook(nil)
+		send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 3, LimitPrice: 50})
+		send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 3, LimitPrice: 51})
+		o := tt.order
+		o.UserID, o.Side = 4, "buy"
+		if r := send(b, &o); r.FilledQty != tt.filled || r.RemainingQty != tt.resting {
+			t.Errorf("%s: filled %d with %d resting, want %d with %d resting", tt.name, r.FilledQty, r.RemainingQty, tt.filled, tt.resting)
+		}
+	}
+
+	b := startBook(nil)
+	aon := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50, AllOrNone: true}
+	send(b, aon)
+	send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 51})
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3}); r.FilledQty != 3 || r.AvgPrice != 51 {
+		t.Errorf("filled %d at %.2f, want the all or none order skipped for 3 at 51", r.FilledQty, r.AvgPrice)
+	}
+	r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 5})
+	if len(r.Fills) != 1 || r.Fills[0] != (Fill{50, 5, aon.OrderID}) {
+		t.Errorf("got fills %+v, want all 5 of the all or none order", r.Fills)
+	}
+}
@@ -0,0 +1,77 @@
+package book
+
+import (
+	"github.com/HuKeping/rbtree"
+)
+
+// Cancels from the API come down the OrderQueue (OrderSchema.Action == ActionCancel), so they are applied on the
+// book's matching goroutine between fills, and report back on OrderSchema.Reply.
+
+// cancel cancels the order c.OrderID if it belongs to c.UserID and is still resting (or waiting on its stop price),
+// reporting what happened to it.  Cancelling an order that is already gone reports how it ended, so retried cancels
+// get the same answer
+func (b *Book) cancel(c *OrderSchema) *ExecutionReport {
+	report := newReport(c.OrderID)
+	report.Status = StatusNotFound
+
+	if o, exists := b.OrderMap[c.OrderID]; exists && o.userID == c.UserID {
+		b.Cancel(o.idNumber)
+		report.CumQty = o.filled
+		report.Status = StatusCancelled
+		if o.filled > 0 {
+			report.Status = StatusPartiallyFilled
+		}
+		return report
+	}
+
+	if o, exists := b.closedOrders[c.OrderID]; exists && o.userID == c.UserID {
+		report.CumQty = o.filled
+		report.Status = StatusCancelled
+		if o.shares+o.reserve == 0 {
+			report.Status = StatusFilled
+		} else if o.filled > 0 {
+			report.Status = StatusPartiallyFilled
+		}
+		return report
+	}
+
+	if b.cancelStop(c.OrderID, c.UserID) {
+		report.Status = StatusCancelled
+	}
+	return report
+}
+
+// cancelStop removes the stop order with orderID owned by userID from the trigger trees or the trailing stops, keeping
+// it with the closed orders.  Returns false if there's no such stop waiting
+func (b *Book) cancelStop(orderID int, userID int) bool {
+	for i, o := range b.trailingStops {
+		if o.OrderID == orderID && o.UserID == userID {
+			b.trailingStops = append(b.trailingStops[:i], b.trailingStops[i+1:]...)
+			b.retire(o, newReport(orderID))
+			return true
+		}
+	}
+
+	for _, tree := range []*rbtree.Rbtree{b.buyStops, b.sellStops} {
+		var found *stopLevel
+		tree.Ascend(tree.Min(), func(item rbtree.Item) bool {
+			l := item.(*stopLevel)
+			for i, o := range l.orders {
+				if o.OrderID == orderID && o.UserID == userID {
+					l.orders = append(l.orders[:i], l.orders[i+1:]...)
+					b.retire(o, newReport(orderID))
+					found = l
+					return false
+				}
+			}
+			return true
+		})
+		if found != nil {
+			if len(found.orders) == 0 {
+				tree.Delete(found)
+			}
+			return true
+		}
+	}
+	return false
+}
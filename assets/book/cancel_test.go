@@ -0,0 +1,53 @@
+package book
+
+import "testing"
+
+// cancelOrder sends a cancel of order orderID by userID to b, and waits for its report
+func cancelOrder(b *Book, orderID int, userID int) *ExecutionReport {
+	return send(b, &OrderSchema{Action: ActionCancel, OrderID: orderID, UserID: userID})
+}
+
+// Cancels report how the order ended, and cancelling it again gets the same answer
+func TestCancelStatus(t *testing.T) {
+	b := startBook(nil)
+	filled := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	partial := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 51}
+	open := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52}
+	send(b, filled)
+	send(b, partial)
+	send(b, open)
+	// Takes the 5 at 50 and 2 of the 5 at 51
+	market := &OrderSchema{UserID: 3, Side: "buy", OrderType: "market", Qty: 7}
+	send(b, market)
+	stop := &OrderSchema{UserID: 4, Side: "buy", OrderType: "stop", Qty: 5, StopPrice: 60}
+	send(b, stop)
+
+	tests := []struct {
+		name    string
+		orderID int
+		userID  int
+		status  string
+		cumQty  int
+	}{
+		{"resting", open.OrderID, 2, StatusCancelled, 0},
+		{"partially filled", partial.OrderID, 2, StatusPartiallyFilled, 2},
+		{"filled", filled.OrderID, 2, StatusFilled, 5},
+		{"filled market order", market.OrderID, 3, StatusFilled, 7},
+		{"waiting stop", stop.OrderID, 4, StatusCancelled, 0},
+		{"someone else's", partial.OrderID, 3, StatusNotFound, 0},
+		{"no such order", 1 << 30, 2, StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		for try := 1; try <= 2; try++ {
+			r := cancelOrder(b, tt.orderID, tt.userID)
+			if r.Status != tt.status || r.CumQty != tt.cumQty || r.FilledQty != 0 || len(r.Fills) != 0 {
+				t.Errorf("%s, cancel %d: %s with %d filled (%d here), want %s with %d", tt.name, try, r.Status, r.CumQty,
+					r.FilledQty, tt.status, tt.cumQty)
+			}
+		}
+	}
+
+	if s, _ := b.GetOrder(partial.OrderID, 2); s.Open || s.Status != StatusPartiallyFilled || s.FilledQty != 2 {
+		t.Errorf("cancelled order still open: %+v", s)
+	}
+}
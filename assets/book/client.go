@@ -0,0 +1,96 @@
+package book
+
+import "sync"
+
+// Users can name their orders with a client order ID of their own (OrderSchema.ClientOrderID), unique per account
+// across every asset.  A new order that reuses one of its owner's client order IDs isn't placed: whoever sent it gets
+// the execution report of the order that first used the ID instead, so retrying a request whose response was lost can't
+// place the order twice.  The rest of the resubmission (qty, price, even the asset) is ignored.
+//
+// Orders that are rejected give their client order ID back, since nothing was placed; a retry of one is treated as a
+// new order.  So do orders the book has forgotten, once they've been closed for the retention window (see lookup.go).
+// FindClientOrder turns a client order ID back into the exchange's order ID, for cancels, amendments and status
+// requests.
+
+// MaxClientOrderIDLength is the most characters a client order ID can have
+const MaxClientOrderIDLength = 64
+
+// clientKey is a client order ID, as used by one account
+type clientKey struct {
+	userID        int
+	clientOrderID string
+}
+
+// clientOrder is the order that first used a client order ID, and its first execution report once it has one
+type clientOrder struct {
+	orderID int
+	ack     *ExecutionReport
+	done    chan struct{} // Closed once ack is set
+}
+
+var clientMu sync.Mutex
+var clientOrders = make(map[clientKey]*clientOrder)
+
+// claimClientOrderID gives new order o, sent to book b, its order ID and registers its client order ID.  If its owner
+// already used that client order ID, o isn't given an ID and the original order is returned instead
+func (b *Book) claimClientOrderID(o *OrderSchema) *clientOrder {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	key := clientKey{o.UserID, o.ClientOrderID}
+	if original, exists := clientOrders[key]; exists {
+		return original
+	}
+	o.OrderID = b.nextOrderID()
+	o.client = &clientOrder{orderID: o.OrderID, done: make(chan struct{})}
+	clientOrders[key] = o.client
+	return nil
+}
+
+// acknowledge records r as the answer to order o's client order ID, for any resubmissions.  Rejected orders give the
+// client order ID back instead
+func (o *OrderSchema) acknowledge(r *ExecutionReport) {
+	if o.client == nil {
+		return
+	}
+	if r.Status == StatusRejected {
+		clientMu.Lock()
+		if clientOrders[clientKey{o.UserID, o.ClientOrderID}] == o.client {
+			delete(clientOrders, clientKey{o.UserID, o.ClientOrderID})
+		}
+		clientMu.Unlock()
+	}
+	o.client.ack = r
+	close(o.client.done)
+}
+
+// forgetClientOrderID gives back the client order ID userID gave order orderID, which the book has forgotten
+func forgetClientOrderID(userID int, clientOrderID string, orderID int) {
+	if clientOrderID == "" {
+		return
+	}
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	key := clientKey{userID, clientOrderID}
+	if c, exists := clientOrders[key]; exists && c.orderID == orderID {
+		delete(clientOrders, key)
+	}
+}
+
+// resend sends the original order's execution report back to resubmission o, once the book has sent it
+func (c *clientOrder) resend(o *OrderSchema) {
+	<-c.done
+	if o.Reply != nil {
+		o.Reply <- c.ack
+	}
+}
+
+// FindClientOrder returns the ID of the order userID gave clientOrderID to; false if they haven't used it
+func FindClientOrder(userID int, clientOrderID string) (int, bool) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if c, exists := clientOrders[clientKey{userID, clientOrderID}]; exists {
+		return c.orderID, true
+	}
+	return 0, false
+}
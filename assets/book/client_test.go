@@ -0,0 +1,42 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// Resubmitting a client order ID gets the original order's report instead of placing the order again, until the
+// original is rejected or forgotten
+func TestClientOrderID(t *testing.T) {
+	b := startBook(nil)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50})
+
+	first := &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3, ClientOrderID: "retry-me"}
+	r := send(b, first)
+	again := &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3, ClientOrderID: "retry-me"}
+	if resent := send(b, again); resent != r || again.OrderID != first.OrderID {
+		t.Errorf("resubmission got order %d's report %+v, want order %d's", again.OrderID, resent, first.OrderID)
+	}
+	if p := position(b, 4); p != 3 {
+		t.Errorf("bought %d shares, want 3", p)
+	}
+	if id, found := FindClientOrder(4, "retry-me"); !found || id != first.OrderID {
+		t.Errorf("client order ID leads to %d, want %d", id, first.OrderID)
+	}
+	// Client order IDs are per account
+	if r := send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "market", Qty: 1, ClientOrderID: "retry-me"}); r.FilledQty != 1 {
+		t.Errorf("another account's order with the same client order ID %s", r.Status)
+	}
+
+	rejected := &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3, ReduceOnly: true, ClientOrderID: "rejected"}
+	send(b, rejected)
+	retry := &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3, ClientOrderID: "rejected"}
+	if r := send(b, retry); r.Status != StatusFilled || retry.OrderID == rejected.OrderID {
+		t.Errorf("retry of a rejected order %s as order %d", r.Status, retry.OrderID)
+	}
+
+	forget(b, closedRetention+time.Second)
+	if _, found := FindClientOrder(4, "retry-me"); found {
+		t.Errorf("client order ID kept after its order was forgotten")
+	}
+}
@@ -0,0 +1,235 @@
+package book
+
+import "github.com/HuKeping/rbtree"
+
+// Orders can carry an execution constraint, for users who only want to trade in blocks:
+//   all or none: every execution has to fill the whole of what's left of the order
+//   min qty:     every execution has to fill at least MinQty shares (or all of what's left, once that's less)
+//
+// An incoming order with a constraint only matches if the book can fill its minimum right away, counting every level up
+// to its limit and combining as many resting orders as it takes.  If it can't, it doesn't trade at all: a limit order
+// that rests goes on the book whole, anything else is cancelled.  Fill or kill orders are checked the same way, as all or
+// none for their whole quantity.
+//
+// Resting orders with a constraint are skipped by any incoming order that can't fill their minimum.  Skipped orders
+// keep their place in the queue, and orders behind them (at the same price, then worse prices) fill instead.  The book
+// only checks constraints when an order comes in, so two resting orders that can't trade with each other can leave it
+// crossed until something fills one of them.  Constrained orders sit out auctions.
+
+// minimumFill returns the smallest execution an order with open unfilled shares will take
+func minimumFill(allOrNone bool, minQty int, open int) int {
+	if allOrNone || minQty > open {
+		return open
+	}
+	return minQty
+}
+
+// minFill returns the smallest fill resting order o will take, 0 if it has no constraint
+func (o *Order) minFill() int {
+	return minimumFill(o.allOrNone, o.minQty, o.shares+o.reserve)
+}
+
+// constrained reports whether resting order o has an execution constraint
+func (o *Order) constrained() bool {
+	return o.allOrNone || o.minQty > 0
+}
+
+// minFill returns how many shares incoming order o has to fill right away to match at all, 0 if it has no constraint
+func (o *OrderSchema) minFill() int {
+	return minimumFill(o.AllOrNone || o.TimeInForce == TimeInForceFOK, o.MinQty, o.Qty)
+}
+
+// allocate asks policy how qty incoming shares fill among orders, which all rest at l (either its displayed or its
+// hidden orders), leaving out any order whose minimum the fill wouldn't meet
+func allocate(policy MatchingPolicy, l *Limit, orders []*Order, qty int) []Allocation {
+	eligible := make([]*Order, 0, len(orders))
+	for _, o := range orders {
+		if o.minFill() <= qty {
+			eligible = append(eligible, o)
+		}
+	}
+
+	for {
+		view := &Limit{LimitPrice: l.LimitPrice, orders: eligible}
+		allocations := policy.Allocate(view, qty)
+
+		// Anyone given less than their minimum drops out, and the rest is allocated again without them
+		short := make(map[*Order]bool)
+		for _, a := range allocations {
+			if a.qty < a.order.minFill() {
+				short[a.order] = true
+			}
+		}
+		if len(short) == 0 {
+			return allocations
+		}
+		kept := eligible[:0:0]
+		for _, o := range eligible {
+			if !short[o] {
+				kept = append(kept, o)
+			}
+		}
+		eligible = kept
+	}
+}
+
+// allocateLevel works out how qty incoming shares fill at l.  Hidden orders only get a share once none of the
+// displayed orders can take any
+func (b *Book) allocateLevel(l *Limit, qty int) []Allocation {
+	if allocations := allocate(b.policy, l, l.orders, qty); len(allocations) > 0 {
+		return allocations
+	}
+	return allocate(FIFO{}, l, l.hidden, qty)
+}
+
+// contraLevels calls f on each price level an incoming buy (or sell) could match against, best first, until f returns false
+func (b *Book) contraLevels(buyOrSell bool, f func(l *Limit) bool) {
+	each := func(item rbtree.Item) bool {
+		return f(item.(*Limit))
+	}
+	if buyOrSell {
+		if best := b.bestOffer(); best != nil {
+			b.sellTree.Ascend(best, each)
+		}
+	} else {
+		if best := b.bestBid(); best != nil {
+			b.BuyTree.Descend(best, each)
+		}
+	}
+}
+
+// nextMatch returns the best price level, up to limitPrice, where an incoming buy (or sell) with qty shares left can
+// trade, and how those shares fill there.  Returns nil if there isn't one
+func (b *Book) nextMatch(buyOrSell bool, limitPrice int, qty int) (*Limit, []Allocation) {
+	var match *Limit
+	var allocations []Allocation
+	b.contraLevels(buyOrSell, func(l *Limit) bool {
+		if !crosses(buyOrSell, l.LimitPrice, limitPrice) {
+			return false
+		}
+		allocations = b.allocateLevel(l, qty)
+		if len(allocations) == 0 {
+			// Nothing here will take what's left of the order, try the next price
+			return true
+		}
+		match = l
+		return false
+	})
+	return match, allocations
+}
+
+// fillable returns how many of upTo shares incoming order t with limitPrice would fill right now, respecting the
+// constraints of the resting orders and what t's self trade prevention mode does when it runs into its owner's own
+// orders.  Like availableVolume, it doesn't know about the ledger
+func (b *Book) fillable(t taker, limitPrice int, upTo int) int {
+	return b.simulate(t, limitPrice, upTo, false, nil)
+}
+
+// simulate works out how sweep would fill up to upTo shares of t, without touching the book, calling fill (if it
+// isn't nil) with the price and qty of each fill.  If displayed is set only the shares showing on the book count: no
+// iceberg reserves or hidden orders.  Returns the shares filled
+func (b *Book) simulate(t taker, limitPrice int, upTo int, displayed bool, fill func(price int, qty int)) int {
+	remaining, filled := upTo, 0
+	stopped := false
+	b.contraLevels(t.buyOrSell, func(l *Limit) bool {
+		if !crosses(t.buyOrSell, l.LimitPrice, limitPrice) {
+			return false
+		}
+		// Icebergs replenish as they fill, so count each one's reserve along with its slice.  Hidden orders only fill
+		// once none of the displayed ones can
+		tiers := []struct {
+			policy MatchingPolicy
+			orders []*Order
+		}{{b.policy, combined(l.orders)}, {FIFO{}, combined(l.hidden)}}
+		if displayed {
+			tiers = tiers[:1]
+			tiers[0].orders = showing(l.orders)
+		}
+		for _, tier := range tiers {
+			orders := tier.orders
+			for remaining > 0 && !stopped {
+				allocations := allocate(tier.policy, l, orders, remaining)
+				if len(allocations) == 0 {
+					break
+				}
+				// Same as sweep: fill down the allocations until one of them is the taker's own
+				var own *Order
+				for _, a := range allocations {
+					if a.order.userID == t.userID {
+						own = a.order
+						break
+					}
+					a.order.shares -= a.qty
+					remaining -= a.qty
+					filled += a.qty
+					if fill != nil {
+						fill(l.LimitPrice, a.qty)
+					}
+				}
+				if own != nil {
+					switch t.stp {
+					case STPCancelOldest:
+						// The own order is cancelled, and the taker carries on
+					case STPDecrementAndCancel:
+						// The taker loses the shares it would have traded with its own order
+						if own.shares < remaining {
+							remaining -= own.shares
+						} else {
+							remaining = 0
+						}
+					default:
+						// Cancel newest and cancel both stop the taker here
+						stopped = true
+					}
+					own.shares = 0
+				}
+				// The copies that filled (or were cancelled) are gone when the level is allocated again
+				left := orders[:0]
+				for _, o := range orders {
+					if o.shares > 0 {
+						left = append(left, o)
+					}
+				}
+				orders = left
+			}
+		}
+		return remaining > 0 && !stopped
+	})
+	return filled
+}
+
+// combined returns copies of orders with each iceberg's reserve added to its displayed shares
+func combined(orders []*Order) []*Order {
+	copies := make([]*Order, len(orders))
+	for i, o := range orders {
+		c := *o
+		c.shares += c.reserve
+		c.reserve = 0
+		copies[i] = &c
+	}
+	return copies
+}
+
+// showing returns copies of orders with just the shares they display, for working out fills without touching them.
+// Icebergs keep their reserve for their minimum, but can't fill from it
+func showing(orders []*Order) []*Order {
+	copies := make([]*Order, len(orders))
+	for i, o := range orders {
+		c := *o
+		copies[i] = &c
+	}
+	return copies
+}
+
+// constrainedVolume returns how many shares resting at l belong to orders with a constraint
+func (l *Limit) constrainedVolume() int {
+	volume := 0
+	for _, orders := range [][]*Order{l.orders, l.hidden} {
+		for _, o := range orders {
+			if o.constrained() {
+				volume += o.shares + o.reserve
+			}
+		}
+	}
+	return volume
+}
@@ -0,0 +1,105 @@
+package book
+
+import (
+	"container/heap"
+	"time"
+)
+
+// Resting DAY and GTD orders are tracked in a min-heap keyed off the time they expire, along with DAY and GTD stops
+// still waiting on their stop price.
+// The book keeps a single timer armed for the earliest expiry; when it fires, MatchOrders
+// cancels everything that is due, so expiring never races with matching.
+//
+// Orders that fill or get cancelled before they expire are left in the heap and skipped when they come due.  So are
+// stops that triggered: whatever rests of them has an expiry of its own.
+
+// expiry is an entry in a Book's expiry heap
+type expiry struct {
+	at    int64 // Unix time the order expires
+	order *Order
+	stop  *OrderSchema // A stop waiting on its stop price instead, nil for resting orders
+}
+
+// expiryQueue implements heap.Interface, earliest expiry first
+type expiryQueue []*expiry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at < q[j].at }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expiryQueue) Push(x interface{}) {
+	*q = append(*q, x.(*expiry))
+}
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// scheduleExpiry registers resting order o to be cancelled at Unix time at.  at == 0 means the order never expires
+func (b *Book) scheduleExpiry(o *Order, at int64) {
+	if at == 0 {
+		return
+	}
+	o.expireTime = at
+	heap.Push(&b.expiries, &expiry{at, o, nil})
+	b.armExpiryTimer()
+}
+
+// scheduleStopExpiry registers DAY/GTD stop o to be cancelled when it expires, if it's still waiting on its stop price
+func (b *Book) scheduleStopExpiry(o *OrderSchema) {
+	at := o.expiresAt()
+	if at == 0 {
+		return
+	}
+	heap.Push(&b.expiries, &expiry{at, nil, o})
+	b.armExpiryTimer()
+}
+
+// armExpiryTimer points the book's expiry timer at the earliest expiry in the heap, if it isn't already
+func (b *Book) armExpiryTimer() {
+	if len(b.expiries) == 0 {
+		if b.expiryTimer != nil {
+			b.expiryTimer.Stop()
+			b.expiryTimer = nil
+		}
+		return
+	}
+
+	next := b.expiries[0].at
+	if b.expiryTimer != nil && b.expiryTimerAt == next {
+		return
+	}
+	if b.expiryTimer != nil {
+		b.expiryTimer.Stop()
+	}
+	b.expiryTimerAt = next
+	b.expiryTimer = time.NewTimer(time.Until(time.Unix(next, 0)))
+}
+
+// expiryC is the channel MatchOrders waits on for the next expiry; nil (blocks forever) when nothing is scheduled
+func (b *Book) expiryC() <-chan time.Time {
+	if b.expiryTimer == nil {
+		return nil
+	}
+	return b.expiryTimer.C
+}
+
+// expireOrders cancels every resting order whose expiry is at or before now, then re-arms the timer
+func (b *Book) expireOrders(now int64) {
+	b.expiryTimer = nil
+	for len(b.expiries) > 0 && b.expiries[0].at <= now {
+		e := heap.Pop(&b.expiries).(*expiry)
+		if e.stop != nil {
+			b.cancelStop(e.stop.OrderID, e.stop.UserID)
+			continue
+		}
+		// Skip orders that already filled or were cancelled
+		if resting, exists := b.OrderMap[e.order.idNumber]; exists && resting == e.order {
+			b.Cancel(e.order.idNumber)
+		}
+	}
+	b.armExpiryTimer()
+}
@@ -0,0 +1,72 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// Whatever an order can't fill right away rests, or is cancelled, according to its time in force
+func TestTimeInForce(t *testing.T) {
+	tests := []struct {
+		tif       string
+		status    string
+		filled    int
+		remaining int
+	}{
+		{TimeInForceGTC, StatusPartiallyFilled, 5, 3},
+		{TimeInForceDAY, StatusPartiallyFilled, 5, 3},
+		{TimeInForceGTD, StatusPartiallyFilled, 5, 3},
+		{TimeInForceIOC, StatusPartiallyFilled, 5, 0},
+		{TimeInForceFOK, StatusCancelled, 0, 0},
+	}
+	for _, tt := range tests {
+		b := startBook(nil)
+		send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50})
+		o := &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 8, LimitPrice: 50, TimeInForce: tt.tif,
+			ExpireTime: time.Now().Add(time.Hour).Unix()}
+		r := send(b, o)
+		if r.Status != tt.status || r.FilledQty != tt.filled || r.RemainingQty != tt.remaining {
+			t.Errorf("%s: %s, filled %d, %d open; want %s, filled %d, %d open",
+				tt.tif, r.Status, r.FilledQty, r.RemainingQty, tt.status, tt.filled, tt.remaining)
+		}
+		if s, _ := b.GetOrder(o.OrderID, 4); s.Open != (tt.remaining > 0) {
+			t.Errorf("%s: open %v after matching", tt.tif, s.Open)
+		}
+	}
+}
+
+// A GTD order is cancelled when it expires
+func TestExpiry(t *testing.T) {
+	b := startBook(nil)
+	o := &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 8, LimitPrice: 50, TimeInForce: TimeInForceGTD,
+		ExpireTime: time.Now().Unix()}
+	send(b, o)
+	waitFor(t, "the order to expire", func() bool {
+		s, _ := b.GetOrder(o.OrderID, 4)
+		return !s.Open && s.Status == StatusCancelled
+	})
+	if best := b.GetBestBid(); best != nil {
+		t.Errorf("expired order still on the book at %d", best.LimitPrice)
+	}
+}
+
+// Stops expire while they wait on their stop price, and don't trigger afterwards
+func TestStopExpiry(t *testing.T) {
+	for _, orderType := range []string{"stop", "trailing_stop"} {
+		b := startBook(nil)
+		trade(b, 50)
+		send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 40})
+		stop := &OrderSchema{UserID: 4, Side: "sell", OrderType: orderType, Qty: 5, StopPrice: 45, TrailAmount: 5,
+			TimeInForce: TimeInForceGTD, ExpireTime: time.Now().Unix()}
+		send(b, stop)
+		waitFor(t, orderType+" to expire", func() bool {
+			s, _ := b.GetOrder(stop.OrderID, 4)
+			return !s.Open && s.Status == StatusCancelled
+		})
+
+		trade(b, 45)
+		if p := position(b, 4); p != 0 {
+			t.Errorf("expired %s traded %d shares", orderType, -p)
+		}
+	}
+}
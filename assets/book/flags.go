@@ -0,0 +1,120 @@
+package book
+
+import (
+	"exchange/users"
+)
+
+// Post-only and reduce-only are checked by ExecuteOrder against the book as it is when the order comes off the
+// OrderQueue, right before it is matched.
+//
+// Reduce-only orders that rest are checked again whenever they trade, since their owner's position can move while they
+// wait.  After every trade its buyer's and seller's resting reduce-only orders are cut down, newest first, so together
+// they're no bigger than the position they reduce; the ones with nothing left are cancelled.
+
+// checkPostOnly makes sure post-only limit order o won't take liquidity.  If it would cross the spread it is either
+// repriced one tick behind the best price on the other side (PostOnlyReprice) or rejected.
+// Returns why the order was rejected, or "" if it can rest
+func (b *Book) checkPostOnly(o *OrderSchema) string {
+	buyOrSell := o.Side == "buy"
+	if b.availableVolume(buyOrSell, o.LimitPrice, 1) == 0 {
+		// Doesn't cross, it'll rest as is
+		return ""
+	}
+	if !o.PostOnlyReprice {
+		return "post only order would cross the spread"
+	}
+
+	if buyOrSell {
+		o.LimitPrice = b.behind(true, b.bestOffer().LimitPrice)
+	} else {
+		o.LimitPrice = b.behind(false, b.bestBid().LimitPrice)
+	}
+	if o.LimitPrice <= 0 {
+		return "post only order has no price left to reprice to"
+	}
+	return ""
+}
+
+// checkReduceOnly makes sure reduce-only order o can only bring its owner's position in this asset closer to zero:
+// a sell can't be for more than the shares they own, and a buy can't be for more than the shares they are short, less
+// what their resting reduce-only orders on the same side already cover.  An order bigger than that is cut down to it.
+// Returns why the order was rejected, or "" if it can go ahead
+func (b *Book) checkReduceOnly(o *OrderSchema) string {
+	buyOrSell := o.Side == "buy"
+	room := b.reducible(o.UserID, buyOrSell)
+	for _, resting := range b.restingReduceOnly(o.UserID, buyOrSell) {
+		room -= resting.shares + resting.reserve
+	}
+
+	if room <= 0 {
+		return "reduce only order has no position to reduce"
+	}
+	if o.Qty > room {
+		o.Qty = room
+	}
+	return ""
+}
+
+// reducible returns how many shares a reduce-only buy (or sell) by userID can trade: the shares they're short (or
+// own), 0 if their position is the other way
+func (b *Book) reducible(userID int, buyOrSell bool) int {
+	position := 0
+	if u := users.GetLedger().GetUser(userID); u != nil {
+		position = u.GetSharesOwned(b.assetID)
+	}
+	if buyOrSell {
+		position = -position
+	}
+	if position < 0 {
+		return 0
+	}
+	return position
+}
+
+// restingReduceOnly returns userID's reduce-only buys (or sells) still resting on the book, oldest first
+func (b *Book) restingReduceOnly(userID int, buyOrSell bool) []*Order {
+	orders := make([]*Order, 0)
+	for _, o := range b.reduceOnly {
+		if resting, exists := b.OrderMap[o.idNumber]; exists && resting == o && o.userID == userID && o.buyOrSell == buyOrSell {
+			orders = append(orders, o)
+		}
+	}
+	return orders
+}
+
+// trimReduceOnly cuts userID's resting reduce-only orders down to the position they reduce, keeping the oldest whole
+// and cancelling any with nothing left.  Returns whether it changed any
+func (b *Book) trimReduceOnly(userID int) bool {
+	// Forget orders that filled or were cancelled
+	live := b.reduceOnly[:0]
+	for _, o := range b.reduceOnly {
+		if resting, exists := b.OrderMap[o.idNumber]; exists && resting == o {
+			live = append(live, o)
+		}
+	}
+	b.reduceOnly = live
+
+	trimmed := false
+	for _, buyOrSell := range []bool{true, false} {
+		orders := b.restingReduceOnly(userID, buyOrSell)
+		if len(orders) == 0 {
+			continue
+		}
+		room := b.reducible(userID, buyOrSell)
+		for _, o := range orders {
+			open := o.shares + o.reserve
+			if open <= room {
+				room -= open
+				continue
+			}
+			if room == 0 {
+				b.Cancel(o.idNumber)
+			} else {
+				b.shrink(o, room)
+				room = 0
+			}
+			trimmed = true
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,81 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// Post only orders never take liquidity: one that would cross is rejected, or repriced a tick behind the spread
+func TestPostOnly(t *testing.T) {
+	b := startBook(nil)
+	b.SetTickSize(5)
+	flush(b)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50})
+
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 50, PostOnly: true}); r.Status != StatusRejected {
+		t.Errorf("crossing post only order %s, want rejected", r.Status)
+	}
+	o := &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 55, PostOnly: true, PostOnlyReprice: true}
+	if r := send(b, o); r.Status != StatusNew || r.FilledQty != 0 {
+		t.Errorf("repriced post only order %s with %d filled, want new with none", r.Status, r.FilledQty)
+	}
+	if s, _ := b.GetOrder(o.OrderID, 4); s.LimitPrice != 45 {
+		t.Errorf("repriced to %d, want 45", s.LimitPrice)
+	}
+	if p := position(b, 4); p != 0 {
+		t.Errorf("post only orders traded %d shares", p)
+	}
+}
+
+// Reduce only orders can't add up to more than the position, and are cut down when it shrinks while they rest
+func TestReduceOnly(t *testing.T) {
+	b := startBook(nil)
+	if r := send(b, &OrderSchema{UserID: 4, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50, ReduceOnly: true}); r.Status != StatusRejected {
+		t.Errorf("reduce only sell with no position %s, want rejected", r.Status)
+	}
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50})
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10})
+
+	older := &OrderSchema{UserID: 4, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52, ReduceOnly: true}
+	newer := &OrderSchema{UserID: 4, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52, ReduceOnly: true}
+	send(b, older)
+	send(b, newer)
+	if r := send(b, &OrderSchema{UserID: 4, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52, ReduceOnly: true}); r.Status != StatusRejected {
+		t.Errorf("reduce only sells for more than the position: third one %s, want rejected", r.Status)
+	}
+
+	// Selling 7 of the 10 leaves 3 to reduce: the newer order goes, the older keeps 3
+	send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 7, LimitPrice: 49})
+	send(b, &OrderSchema{UserID: 4, Side: "sell", OrderType: "market", Qty: 7})
+	if s, _ := b.GetOrder(older.OrderID, 4); !s.Open || s.RemainingQty != 3 {
+		t.Errorf("older reduce only order %+v, want 3 open", s)
+	}
+	if s, _ := b.GetOrder(newer.OrderID, 4); s.Open || s.Status != StatusCancelled {
+		t.Errorf("newer reduce only order %+v, want cancelled", s)
+	}
+
+	send(b, &OrderSchema{UserID: 3, Side: "buy", OrderType: "market", Qty: 20})
+	if p := position(b, 4); p != 0 {
+		t.Errorf("position %d after reduce only sells, want 0", p)
+	}
+}
+
+// At an uncross, reduce only orders stop at the position the auction's earlier trades leave
+func TestReduceOnlyAuction(t *testing.T) {
+	b := startBook(nil)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50})
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10})
+
+	b.StartAuction(time.Hour)
+	flush(b)
+	send(b, &OrderSchema{UserID: 4, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50, ReduceOnly: true})
+	// Market orders go first, so this sells the whole position before the reduce only order gets to trade
+	send(b, &OrderSchema{UserID: 4, Side: "sell", OrderType: "market", Qty: 10})
+	send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 20, LimitPrice: 50})
+	b.StartAuction(time.Millisecond)
+	waitFor(t, "the uncross", func() bool { return b.GetState() == StateContinuous })
+
+	if p := position(b, 4); p != 0 {
+		t.Errorf("position %d after the uncross, want 0", p)
+	}
+}
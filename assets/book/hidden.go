@@ -0,0 +1,65 @@
+package book
+
+// A hidden order rests on the book and matches like any other, but isn't displayed: it doesn't count toward its
+// Limit's Size or TotalVolume, and a level with only hidden orders is left out of InOrderTraversal.
+// Each Limit keeps its hidden orders in their own queue behind the displayed ones, so at the same price every displayed
+// share (including iceberg reserves) fills before any hidden share, whatever the book's MatchingPolicy.  Hidden orders
+// fill oldest first.
+//
+// TotalOrders and TotalLiquidity count everything at a Limit, for anything that needs the real liquidity.
+
+// TotalOrders returns the number of orders at the limit, displayed and hidden
+func (l *Limit) TotalOrders() int {
+	return len(l.orders) + len(l.hidden)
+}
+
+// TotalLiquidity returns the number of shares that can match at the limit: displayed, iceberg reserves and hidden
+func (l *Limit) TotalLiquidity() int {
+	return l.TotalVolume + l.reserveVolume + l.hiddenVolume
+}
+
+// join adds order o to the back of its queue at l
+func (l *Limit) join(o *Order) {
+	o.parentLimit = l
+	if o.hidden {
+		l.hidden = append(l.hidden, o)
+		l.hiddenVolume += o.shares
+		return
+	}
+	l.orders = append(l.orders, o)
+	l.Size++
+	l.TotalVolume += o.shares
+	l.reserveVolume += o.reserve
+}
+
+// leave takes order o out of its queue at l
+func (l *Limit) leave(o *Order) {
+	queue := &l.orders
+	if o.hidden {
+		queue = &l.hidden
+	}
+	for i, resting := range *queue {
+		if resting == o {
+			*queue = append((*queue)[:i], (*queue)[i+1:]...)
+			// Break so as not to have bad access (ex delete first item in list of 2 then access l[1])
+			break
+		}
+	}
+
+	if o.hidden {
+		l.hiddenVolume -= o.shares
+		return
+	}
+	l.Size--
+	l.TotalVolume -= o.shares
+	l.reserveVolume -= o.reserve
+}
+
+// take takes qty of order o's shares, which just filled or were cancelled, off l's totals
+func (l *Limit) take(o *Order, qty int) {
+	if o.hidden {
+		l.hiddenVolume -= qty
+		return
+	}
+	l.TotalVolume -= qty
+}
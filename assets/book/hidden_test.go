@@ -0,0 +1,35 @@
+package book
+
+import "testing"
+
+// Hidden orders don't show on the book, and only fill once every displayed share at their price has, oldest first
+func TestHiddenPriority(t *testing.T) {
+	for _, policy := range []MatchingPolicy{FIFO{}, ProRata{}} {
+		b := startBook(policy)
+		first := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 4, LimitPrice: 50, Hidden: true}
+		send(b, first)
+		second := &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 4, LimitPrice: 50, Hidden: true}
+		send(b, second)
+		if _, sells := b.InOrderTraversal(); len(sells) != 0 {
+			t.Errorf("%T: a level of only hidden orders shows on the book", policy)
+		}
+
+		shown := &OrderSchema{UserID: 5, Side: "sell", OrderType: "limit", Qty: 4, LimitPrice: 50, DisplayQty: 2}
+		send(b, shown)
+		if v := b.GetVolumeAtLimit(50); v != 2 {
+			t.Errorf("%T: volume at 50 is %d, want only the 2 shares displayed", policy, v)
+		}
+
+		r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10})
+		want := []Fill{{50, 2, shown.OrderID}, {50, 2, shown.OrderID}, {50, 4, first.OrderID}, {50, 2, second.OrderID}}
+		if len(r.Fills) != len(want) {
+			t.Fatalf("%T: got fills %+v, want %+v", policy, r.Fills, want)
+		}
+		for i := range want {
+			if r.Fills[i] != want[i] {
+				t.Errorf("%T: got fills %+v, want %+v", policy, r.Fills, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package book
+
+// An iceberg (reserve) order only shows displayQty of its shares on the book at a time; the rest is held in reserve.
+// Only the displayed slice counts toward its Limit's TotalVolume, the reserve is tracked separately in reserveVolume
+// so the matching engine still knows the real liquidity at that price.
+// When the displayed slice is filled, the next slice is taken from the reserve and joins the back of the Limit's
+// queue, losing its time priority like any new order would.
+
+// setDisplay splits an order that hasn't been placed yet into a displayed slice of displayQty and a reserve.
+// displayQty of 0, or at least the order's size, displays the whole order
+func (o *Order) setDisplay(displayQty int) {
+	o.displayQty = displayQty
+	if displayQty <= 0 || displayQty >= o.shares {
+		return
+	}
+	o.reserve = o.shares - displayQty
+	o.shares = displayQty
+}
+
+// replenish shows the next slice of iceberg order o, whose displayed slice just filled, at the back of its Limit's queue
+func (b *Book) replenish(o *Order) {
+	l := o.parentLimit
+	for i, resting := range l.orders {
+		if resting == o {
+			l.orders = append(l.orders[:i], l.orders[i+1:]...)
+			break
+		}
+	}
+	l.orders = append(l.orders, o)
+
+	o.shares = o.displayQty
+	if o.reserve < o.shares {
+		o.shares = o.reserve
+	}
+	o.reserve -= o.shares
+
+	l.TotalVolume += o.shares
+	l.reserveVolume -= o.shares
+}
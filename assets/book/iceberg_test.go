@@ -0,0 +1,40 @@
+package book
+
+import "testing"
+
+// An iceberg only shows its display size, and each slice it shows from its reserve goes to the back of the queue
+func TestIceberg(t *testing.T) {
+	b := startBook(nil)
+	iceberg := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50, DisplayQty: 3}
+	send(b, iceberg)
+	behind := &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	send(b, behind)
+	if v := b.GetVolumeAtLimit(50); v != 8 {
+		t.Errorf("volume at 50 is %d, want the 3 shown plus 5", v)
+	}
+
+	// The first slice still has priority
+	r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 3})
+	if len(r.Fills) != 1 || r.Fills[0].CounterParty != iceberg.OrderID {
+		t.Errorf("got fills %+v, want 3 from the iceberg", r.Fills)
+	}
+	if v := b.GetVolumeAtLimit(50); v != 8 {
+		t.Errorf("volume at 50 is %d after a slice filled, want the next 3 shown plus 5", v)
+	}
+
+	// The next slice is behind the order that was queued after the iceberg
+	r = send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 6})
+	want := []Fill{{50, 5, behind.OrderID}, {50, 1, iceberg.OrderID}}
+	if len(r.Fills) != len(want) || r.Fills[0] != want[0] || r.Fills[1] != want[1] {
+		t.Errorf("got fills %+v, want %+v", r.Fills, want)
+	}
+
+	// An order bigger than the slice showing keeps filling from the reserve
+	r = send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10})
+	if r.FilledQty != 6 || r.Status != StatusPartiallyFilled {
+		t.Errorf("filled %d of the iceberg's last 6, %s", r.FilledQty, r.Status)
+	}
+	if v := b.GetVolumeAtLimit(50); v != 0 {
+		t.Errorf("volume at 50 is %d once the iceberg is gone", v)
+	}
+}
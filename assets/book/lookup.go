@@ -0,0 +1,186 @@
+package book
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HuKeping/rbtree"
+)
+
+// Order IDs come from a single counter shared by every book, so an ID names one order on the whole exchange, and they
+// can be handed out from any goroutine.  Each order is registered against its book when it gets its ID, so FindOrder
+// can find it from the ID alone; GetOrder then says where it's up to.
+//
+// Orders aren't remembered forever.  A rejected order's ID is forgotten as soon as it's rejected, and an order that's
+// done (filled, cancelled or expired) is kept with the book's closed orders for closedRetention, then forgotten too.
+// Lookups and cancels of a forgotten order get not_found.
+
+// closedRetention is how long orders that are done can still be looked up
+var closedRetention = 24 * time.Hour
+
+var curID int64
+
+// orderBooks maps every order ID handed out to the *Book the order was sent to
+var orderBooks sync.Map
+
+// nextOrderID hands out the next order ID, for an order sent to book b
+func (b *Book) nextOrderID() int {
+	id := int(atomic.AddInt64(&curID, 1))
+	orderBooks.Store(id, b)
+	return id
+}
+
+// FindOrder returns the book order orderID was sent to, nil if no order has that ID
+func FindOrder(orderID int) *Book {
+	if b, exists := orderBooks.Load(orderID); exists {
+		return b.(*Book)
+	}
+	return nil
+}
+
+// GetAssetID returns the ID of the book's asset
+func (b *Book) GetAssetID() int {
+	return b.assetID
+}
+
+// OrderState is where an order is up to
+type OrderState struct {
+	OrderID       int    `json:"order_id"`
+	ClientOrderID string `json:"client_order_id,omitempty"`
+	UserID        int    `json:"user_id"`
+	AssetID       int    `json:"asset_id"`
+	Side          string `json:"side"`
+	Status        string `json:"status"` // new or partially_filled while it's open, then filled, partially_filled or cancelled
+	Open          bool   `json:"open"`   // Whether it's still resting on the book, or waiting on its stop price or an auction
+	FilledQty     int    `json:"filled_qty"`
+	RemainingQty  int    `json:"remaining_qty"` // Shares still open
+	LimitPrice    int    `json:"limit,omitempty"`
+}
+
+// GetOrder returns the state of order orderID, if it's in this book and belongs to userID.  Orders that were rejected
+// aren't kept
+func (b *Book) GetOrder(orderID int, userID int) (OrderState, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if o, exists := b.OrderMap[orderID]; exists && o.userID == userID {
+		s := b.orderState(o)
+		s.Open = true
+		s.Status = StatusNew
+		if o.filled > 0 {
+			s.Status = StatusPartiallyFilled
+		}
+		s.RemainingQty = o.shares + o.reserve
+		return s, true
+	}
+
+	if o, exists := b.closedOrders[orderID]; exists && o.userID == userID {
+		// Same as cancel reports on a closed order
+		s := b.orderState(o)
+		s.Status = StatusCancelled
+		if o.shares+o.reserve == 0 {
+			s.Status = StatusFilled
+		} else if o.filled > 0 {
+			s.Status = StatusPartiallyFilled
+		}
+		return s, true
+	}
+
+	if o := b.waiting(orderID); o != nil && o.UserID == userID {
+		status := StatusNew
+		if o.filled > 0 {
+			status = StatusPartiallyFilled
+		}
+		return OrderState{o.OrderID, o.ClientOrderID, o.UserID, b.assetID, o.Side, status, true, o.filled, o.Qty, o.LimitPrice}, true
+	}
+	return OrderState{}, false
+}
+
+// orderState fills in the parts of an OrderState that come straight from o
+func (b *Book) orderState(o *Order) OrderState {
+	side := "sell"
+	if o.buyOrSell {
+		side = "buy"
+	}
+	return OrderState{OrderID: o.idNumber, ClientOrderID: o.clientOrderID, UserID: o.userID, AssetID: b.assetID, Side: side, FilledQty: o.filled, LimitPrice: o.limit}
+}
+
+// waiting returns order orderID if it's a stop waiting on its stop price, or a market order waiting for the uncross
+func (b *Book) waiting(orderID int) *OrderSchema {
+	for _, o := range b.trailingStops {
+		if o.OrderID == orderID {
+			return o
+		}
+	}
+	for _, o := range b.auctionOrders {
+		if o.OrderID == orderID {
+			return o
+		}
+	}
+
+	var found *OrderSchema
+	for _, tree := range []*rbtree.Rbtree{b.buyStops, b.sellStops} {
+		tree.Ascend(tree.Min(), func(item rbtree.Item) bool {
+			for _, o := range item.(*stopLevel).orders {
+				if o.OrderID == orderID {
+					found = o
+					return false
+				}
+			}
+			return true
+		})
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// retire keeps incoming order o, which finished matching (as r reports) without resting, with the closed orders, so it
+// can still be looked up and cancels of it get the same answer as they would for an order that rested
+func (b *Book) retire(o *OrderSchema, r *ExecutionReport) {
+	unfilled := o.Qty - r.FilledQty
+	if o.Notional > 0 {
+		// Notional buys don't have a qty, only whether they spent all they could
+		unfilled = 0
+		if r.Status != StatusFilled {
+			unfilled = 1
+		}
+	}
+	closed := createOrder(o.OrderID, o.UserID, o.Side == "buy", unfilled, o.LimitPrice, o.EntryTime)
+	closed.filled = r.FilledQty
+	closed.clientOrderID = o.ClientOrderID
+	b.closeOrder(closed)
+}
+
+// closedEntry is an order that was added to closedOrders at Unix time at
+type closedEntry struct {
+	at    int64
+	order *Order
+}
+
+// closeOrder keeps order o, which is done, with the closed orders for closedRetention
+func (b *Book) closeOrder(o *Order) {
+	o.closedAt = time.Now().Unix()
+	b.closedOrders[o.idNumber] = o
+	b.closing = append(b.closing, closedEntry{o.closedAt, o})
+}
+
+// forgetClosed forgets every order that closed more than closedRetention before Unix time now: its ID, its client
+// order ID and the closed order itself
+func (b *Book) forgetClosed(now int64) {
+	cutoff := now - int64(closedRetention/time.Second)
+	n := 0
+	for ; n < len(b.closing) && b.closing[n].at <= cutoff; n++ {
+		o := b.closing[n].order
+		if b.closedOrders[o.idNumber] != o || o.closedAt != b.closing[n].at {
+			// Put back on the book by an amendment since, and maybe closed again later
+			continue
+		}
+		delete(b.closedOrders, o.idNumber)
+		orderBooks.Delete(o.idNumber)
+		forgetClientOrderID(o.userID, o.clientOrderID, o.idNumber)
+	}
+	b.closing = b.closing[n:]
+}
@@ -0,0 +1,46 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// forget has b forget its closed orders as if after is how long it's been since now
+func forget(b *Book, after time.Duration) {
+	done := make(chan struct{})
+	b.controls <- func() {
+		b.forgetClosed(time.Now().Add(after).Unix())
+		close(done)
+	}
+	<-done
+}
+
+// Closed orders are kept for closedRetention, and rejected orders not at all
+func TestForgetClosed(t *testing.T) {
+	b := startBook(nil)
+	rejected := &OrderSchema{UserID: 4, Side: "sell", OrderType: "market", Qty: 5, ReduceOnly: true}
+	if r := send(b, rejected); r.Status != StatusRejected || FindOrder(rejected.OrderID) != nil {
+		t.Errorf("rejected order %s, kept: %v", r.Status, FindOrder(rejected.OrderID) != nil)
+	}
+
+	cancelled := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	resting := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 51}
+	send(b, cancelled)
+	send(b, resting)
+	cancelOrder(b, cancelled.OrderID, 2)
+
+	forget(b, closedRetention/2)
+	if s, found := b.GetOrder(cancelled.OrderID, 2); !found || s.Status != StatusCancelled {
+		t.Errorf("cancelled order forgotten early: %+v, %v", s, found)
+	}
+	forget(b, closedRetention+time.Second)
+	if _, found := b.GetOrder(cancelled.OrderID, 2); found || FindOrder(cancelled.OrderID) != nil {
+		t.Errorf("cancelled order kept past closedRetention")
+	}
+	if r := cancelOrder(b, cancelled.OrderID, 2); r.Status != StatusNotFound {
+		t.Errorf("cancel of a forgotten order %s, want not_found", r.Status)
+	}
+	if s, found := b.GetOrder(resting.OrderID, 2); !found || !s.Open || FindOrder(resting.OrderID) != b {
+		t.Errorf("resting order forgotten: %+v, %v", s, found)
+	}
+}
@@ -0,0 +1,125 @@
+package book
+
+import "sort"
+
+// A MatchingPolicy decides how an incoming order's shares are shared out among the resting orders at the best price level.
+// Each book gets one when its asset is created (see assets.CreateAsset); sweep asks it for an allocation at each level
+// it matches against.
+//
+// Policies only see the displayed shares of each order (Order.shares).  When an iceberg's slice fills, it replenishes and
+// sweep asks the policy to allocate again at the same level.  Hidden orders are left out too: sweep fills them oldest
+// first, once the level's displayed orders are gone (see hidden.go).  Orders with execution constraints are only
+// offered to the policy if the incoming order can meet them, see constraints.go.
+
+// MatchingPolicy allocates incoming shares at a price level
+type MatchingPolicy interface {
+	// Allocate splits qty shares among the orders resting at l, never giving an order more than its shares, and giving
+	// out min(qty, l.TotalVolume) altogether.  Allocations come back in the order they should be filled
+	Allocate(l *Limit, qty int) []Allocation
+}
+
+// Allocation is how many shares of an incoming order a single resting order gets
+type Allocation struct {
+	order *Order
+	qty   int
+}
+
+// FIFO is price-time priority: the oldest order at the level fills first, then the next oldest, and so on
+type FIFO struct{}
+
+// Allocate fills the level's orders oldest first
+func (FIFO) Allocate(l *Limit, qty int) []Allocation {
+	allocations := make([]Allocation, 0)
+	for _, o := range l.orders {
+		if qty == 0 {
+			break
+		}
+		fill := o.shares
+		if qty < fill {
+			fill = qty
+		}
+		allocations = append(allocations, Allocation{o, fill})
+		qty -= fill
+	}
+	return allocations
+}
+
+// ProRata shares the incoming order among every order at the level in proportion to its size.
+// Each order gets its share rounded down; the shares left over from rounding go one at a time to the
+// largest orders (oldest first between equal sizes) that still have room
+type ProRata struct{}
+
+// Allocate splits qty across the level's orders proportionally to their shares
+func (ProRata) Allocate(l *Limit, qty int) []Allocation {
+	return proRata(l.orders, qty)
+}
+
+// TopOrderProRata is FIFO for the top order, pro-rata for everyone else: the oldest order at the level fills first,
+// up to its full size, and whatever is left is shared among the rest of the level pro-rata.
+// It rewards whoever was first to set the price, while still sharing the level among everyone behind them
+type TopOrderProRata struct{}
+
+// Allocate fills the level's oldest order, then splits what's left across the others proportionally
+func (TopOrderProRata) Allocate(l *Limit, qty int) []Allocation {
+	if len(l.orders) == 0 {
+		return make([]Allocation, 0)
+	}
+
+	top := l.orders[0]
+	fill := top.shares
+	if qty < fill {
+		fill = qty
+	}
+	allocations := []Allocation{{top, fill}}
+	return append(allocations, proRata(l.orders[1:], qty-fill)...)
+}
+
+// proRata splits qty among orders in proportion to their shares, with the rounding rules described on ProRata.
+// Allocations come back in time priority, skipping orders that got nothing
+func proRata(orders []*Order, qty int) []Allocation {
+	volume := 0
+	for _, o := range orders {
+		volume += o.shares
+	}
+	if qty > volume {
+		qty = volume
+	}
+	if qty <= 0 {
+		return make([]Allocation, 0)
+	}
+
+	shares := make([]int, len(orders))
+	allocated := 0
+	for i, o := range orders {
+		shares[i] = qty * o.shares / volume
+		allocated += shares[i]
+	}
+
+	// Hand out what's left from rounding down, biggest orders first, oldest first between equals
+	byLargest := make([]int, len(orders))
+	for i := range byLargest {
+		byLargest[i] = i
+	}
+	sort.SliceStable(byLargest, func(a, b int) bool {
+		return orders[byLargest[a]].shares > orders[byLargest[b]].shares
+	})
+	for allocated < qty {
+		for _, i := range byLargest {
+			if allocated == qty {
+				break
+			}
+			if shares[i] < orders[i].shares {
+				shares[i]++
+				allocated++
+			}
+		}
+	}
+
+	allocations := make([]Allocation, 0)
+	for i, o := range orders {
+		if shares[i] > 0 {
+			allocations = append(allocations, Allocation{o, shares[i]})
+		}
+	}
+	return allocations
+}
@@ -0,0 +1,20 @@
+package book
+
+// A notional market buy is for an amount of cash (OrderSchema.Notional) instead of a number of shares.  It sweeps the
+// book like any market order, but at each level only takes as many whole shares as the cash it has left covers, and
+// stops once it can't afford another share.  Whatever cash it didn't spend comes back in the report as UnspentCash.
+//
+// Like any market order, it stops at its protection price, if it has one (see protection.go).  Notional orders never
+// rest, so anything left when it gets there (or to the price bands) is cancelled.
+
+// executeNotional matches notional market buy o
+func (b *Book) executeNotional(o *OrderSchema) *ExecutionReport {
+	r := newReport(o.OrderID)
+	limitPrice := b.protectionLimit(o)
+
+	// At a price of at least 1, the cash never buys more than Notional shares
+	o.SelfTradePrevention = selfTradeMode(o.SelfTradePrevention, o.UserID)
+	b.sweep(taker{o.OrderID, o.UserID, true, o.SelfTradePrevention, o.Notional}, o.Notional, limitPrice, r)
+	r.settleNotional(o.Notional)
+	return r
+}
@@ -0,0 +1,35 @@
+package book
+
+import "testing"
+
+// Notional buys take as many whole shares as their cash covers at each level, and hand back what they couldn't spend
+func TestNotional(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   OrderSchema
+		filled  int
+		unspent int
+		status  string
+	}{
+		{"spends all it can", OrderSchema{Notional: 200}, 5, 30, StatusFilled},
+		{"runs out of book", OrderSchema{Notional: 1000}, 8, 1000 - 3*30 - 5*40, StatusPartiallyFilled},
+		{"can't afford a share", OrderSchema{Notional: 20}, 0, 20, StatusCancelled},
+		{"stops at its protection price", OrderSchema{Notional: 200, ProtectionPrice: 35}, 3, 110, StatusPartiallyFilled},
+	}
+	for _, tt := range tests {
+		b := startBook(nil)
+		send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 3, LimitPrice: 30})
+		send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 40})
+
+		o := tt.order
+		o.UserID, o.Side, o.OrderType = 4, "buy", "market"
+		r := send(b, &o)
+		if r.FilledQty != tt.filled || r.UnspentCash != tt.unspent || r.Status != tt.status || r.RemainingQty != 0 {
+			t.Errorf("%s: bought %d with %d unspent and %d open, %s; want %d with %d unspent, %s",
+				tt.name, r.FilledQty, r.UnspentCash, r.RemainingQty, r.Status, tt.filled, tt.unspent, tt.status)
+		}
+		if p := position(b, 4); p != tt.filled {
+			t.Errorf("%s: position %d, want %d", tt.name, p, tt.filled)
+		}
+	}
+}
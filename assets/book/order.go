@@ -1,11 +1,109 @@
 package book
 
+import "time"
+
+// Actions an OrderSchema can ask of a book, sent in OrderSchema.Action
+const (
+	ActionNew    = ""       // Place a new order (default)
+	ActionAmend  = "amend"  // Change the price and/or quantity of the resting order with OrderSchema.OrderID
+	ActionCancel = "cancel" // Cancel the order with OrderSchema.OrderID, reporting on OrderSchema.Reply
+)
+
+// Time in force policies, sent in OrderSchema.TimeInForce
+const (
+	TimeInForceGTC = "gtc" // Good till cancelled: rests on the book until it fills or is cancelled (default)
+	TimeInForceDAY = "day" // Rests on the book until the end of the day it was entered
+	TimeInForceIOC = "ioc" // Immediate or cancel: whatever can't be filled right away is cancelled
+	TimeInForceFOK = "fok" // Fill or kill: filled in full right away, or not at all
+	TimeInForceGTD = "gtd" // Good till date: rests on the book until OrderSchema.ExpireTime
+)
+
 // OrderSchema defines the schema for an order received over http
 type OrderSchema struct {
+	UserID      int    `json:"user_id"` // Account placing the order; settled against in the ledger
 	Symbol      string `json:"symbol"`
 	Qty         int    `json:"qty"`
 	OrderType   string `json:"type"`
 	Side        string `json:"side"`
 	LimitPrice  int    `json:"limit"`
+	StopPrice   int    `json:"stop_price"`  // Market price that releases a stop or stop_limit order
+	DisplayQty  int    `json:"display_qty"` // Iceberg orders only show this many shares of a resting limit at a time
+	Hidden      bool   `json:"hidden"`      // Hidden limit orders rest without showing on the book, and fill after displayed orders at their price
+	AllOrNone   bool   `json:"all_or_none"` // Every execution has to fill the whole of what's left of the order
+	MinQty      int    `json:"min_qty"`     // Every execution has to fill at least this many shares (or all of what's left)
 	TimeInForce string `json:"time_in_force"`
+	ExpireTime  int64  `json:"expire_time"` // Unix time a GTD order expires, ignored otherwise
+
+	// Notional market buys spend an amount of cash instead of buying Qty shares (see notional.go)
+	Notional int `json:"notional"` // Cash to spend
+
+	// Protected market orders stop sweeping at the tighter of these (see protection.go)
+	ProtectionPrice int     `json:"protection_price"` // Worst price the order trades at, 0 for none
+	MaxSlippage     float64 `json:"max_slippage"`     // Furthest it trades from the best price when it arrives, in percent; 0 for no cap
+
+	PostOnly        bool `json:"post_only"`         // Limit order may only add liquidity; rejected if it would cross the spread
+	PostOnlyReprice bool `json:"post_only_reprice"` // Reprice a crossing post only order one tick behind the spread instead of rejecting it
+	ReduceOnly      bool `json:"reduce_only"`       // Order may only reduce the user's position in the asset
+
+	SelfTradePrevention string `json:"stp"` // What to do if the order would trade with its owner's own order, one of the STP modes
+
+	// Trailing stops trail the best market price since entry by either a fixed amount or a percentage
+	TrailAmount  int     `json:"trail_amount"`
+	TrailPercent float64 `json:"trail_percent"`
+	LimitOffset  int     `json:"limit_offset"` // How far past its stop price a trailing_stop_limit's limit is set when it triggers
+
+	// Pegged limit orders rest at a price the book keeps following, instead of LimitPrice (see peg.go)
+	Peg       string `json:"peg"`        // What the order is pegged to, one of the Peg constants; empty if it isn't pegged
+	PegOffset int    `json:"peg_offset"` // Added to the peg's reference price
+	PegCap    int    `json:"peg_cap"`    // Highest price a pegged buy (lowest a pegged sell) will rest at, 0 for no cap
+
+	// Users can name an order with an ID of their own, unique per account; resubmitting one doesn't place it again (see client.go)
+	ClientOrderID string `json:"client_order_id"`
+
+	Action    string `json:"-"` // What the book should do with this, one of the Action constants. Set by the API
+	OrderID   int    `json:"-"` // ID of a new order, set by Book.EnqueueOrder; for amendments and cancels, the order they apply to
+	EntryTime int64  `json:"-"` // Time received by API, set by Book.EnqueueOrder
+
+	Reply chan *ExecutionReport `json:"-"` // Where the book reports back once, if anyone is listening. Should be buffered
+
+	trailRef int          // Best market price seen since a trailing stop was entered
+	reported bool         // Whether an ExecutionReport has been sent on Reply yet
+	client   *clientOrder // Registration of the order's client order ID, if it has one
+	filled   int          // Shares a market order waiting for the uncross has filled, Qty is what's left of it
+}
+
+// ValidOrderType reports whether orderType is one of the supported order types
+func ValidOrderType(orderType string) bool {
+	switch orderType {
+	case "market", "limit", "stop", "stop_limit", "trailing_stop", "trailing_stop_limit", "market_to_limit":
+		return true
+	}
+	return false
+}
+
+// ValidTimeInForce reports whether tif is one of the supported time in force policies
+func ValidTimeInForce(tif string) bool {
+	switch tif {
+	case TimeInForceGTC, TimeInForceDAY, TimeInForceIOC, TimeInForceFOK, TimeInForceGTD:
+		return true
+	}
+	return false
+}
+
+// expiresAt returns the Unix time the resting part of this order should be cancelled, or 0 if it never expires
+func (o *OrderSchema) expiresAt() int64 {
+	switch o.TimeInForce {
+	case TimeInForceDAY:
+		// Midnight (server time) after the order was received
+		y, m, d := time.Unix(o.EntryTime, 0).Date()
+		return time.Date(y, m, d+1, 0, 0, 0, 0, time.Local).Unix()
+	case TimeInForceGTD:
+		return o.ExpireTime
+	}
+	return 0
+}
+
+// rests reports whether any unfilled part of this order should be added to the book
+func (o *OrderSchema) rests() bool {
+	return o.TimeInForce != TimeInForceIOC && o.TimeInForce != TimeInForceFOK
 }
@@ -0,0 +1,173 @@
+package book
+
+import (
+	"time"
+
+	"github.com/HuKeping/rbtree"
+)
+
+// A pegged order is a limit order whose price follows the book instead of staying where it was put:
+//   bid:   the best bid, plus PegOffset
+//   offer: the best offer, plus PegOffset
+//   mid:   halfway between the two (rounded to the tick below for buys, above for sells), plus PegOffset
+// never past PegCap (if it has one).  The references are the best prices of unpegged orders, so pegged orders can't
+// chase each other around.
+//
+// Pegged orders only ever add liquidity: they're placed one tick (see ticks.go) behind the other side of the book if
+// their peg would cross it, and never match when they're placed or moved (they can still be matched by incoming orders,
+// like any other resting order).  Whenever highestBuy or lowestSell changes, MatchOrders reprices every pegged order after the order
+// that moved them.  A pegged order that moves goes to the back of the queue at its new price, same as any order
+// arriving there; one that doesn't move keeps its place.  If there's nothing to peg to (e.g. no bids) it stays put.
+
+// What a pegged order can follow, sent in OrderSchema.Peg
+const (
+	PegBid   = "bid"
+	PegOffer = "offer"
+	PegMid   = "mid"
+)
+
+// ValidPeg reports whether peg is one of the Peg constants
+func ValidPeg(peg string) bool {
+	switch peg {
+	case PegBid, PegOffer, PegMid:
+		return true
+	}
+	return false
+}
+
+// restPegged places new pegged order o at its peg.  Rejects it if there's nothing to peg to
+func (b *Book) restPegged(o *OrderSchema) *ExecutionReport {
+	buyOrSell := o.Side == "buy"
+	bid, offer := b.pegReferences()
+	price, ok := b.pegPrice(buyOrSell, o.Peg, o.PegOffset, o.PegCap, bid, offer)
+	if !ok {
+		return rejection(o, "nothing to peg to")
+	}
+	o.LimitPrice = price
+	b.rest(o, buyOrSell, o.Qty)
+	r := newReport(o.OrderID)
+	r.settle(o.Qty, o.Qty)
+	return r
+}
+
+// pegReferences returns the best bid and offer among unpegged orders, 0 if a side doesn't have any
+func (b *Book) pegReferences() (int, int) {
+	bid, offer := 0, 0
+	unpegged := func(ref *int) rbtree.Iterator {
+		return func(item rbtree.Item) bool {
+			l := item.(*Limit)
+			for _, o := range l.orders {
+				if o.peg == "" {
+					*ref = l.LimitPrice
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if best := b.bestBid(); best != nil {
+		b.BuyTree.Descend(best, unpegged(&bid))
+	}
+	if best := b.bestOffer(); best != nil {
+		b.sellTree.Ascend(best, unpegged(&offer))
+	}
+	return bid, offer
+}
+
+// pegPrice works out where a buy (or sell) pegged to peg should rest, given the unpegged best bid and offer.
+// ok is false if there's nothing to peg to
+func (b *Book) pegPrice(buyOrSell bool, peg string, offset int, cap int, bid int, offer int) (int, bool) {
+	price := 0
+	switch peg {
+	case PegBid:
+		price = bid
+	case PegOffer:
+		price = offer
+	case PegMid:
+		if bid == 0 || offer == 0 {
+			return 0, false
+		}
+		price = b.onTick(true, (bid+offer)/2)
+		if !buyOrSell {
+			price = b.onTick(false, (bid+offer+1)/2)
+		}
+	}
+	if price == 0 {
+		return 0, false
+	}
+	price += offset
+
+	if buyOrSell {
+		if cap > 0 && price > cap {
+			price = cap
+		}
+		// Don't cross the spread
+		if best := b.bestOffer(); best != nil && price >= best.LimitPrice {
+			price = b.behind(true, best.LimitPrice)
+		}
+	} else {
+		if cap > 0 && price < cap {
+			price = cap
+		}
+		if best := b.bestBid(); best != nil && price <= best.LimitPrice {
+			price = b.behind(false, best.LimitPrice)
+		}
+	}
+	return price, price > 0
+}
+
+// repeg reprices the book's pegged orders, if the best bid or offer has moved since they were last priced
+func (b *Book) repeg() {
+	if b.state != StateContinuous || len(b.pegged) == 0 {
+		return
+	}
+	if b.pegState() == b.pegPrices {
+		return
+	}
+
+	// Forget orders that filled or were cancelled
+	live := b.pegged[:0]
+	for _, o := range b.pegged {
+		if resting, exists := b.OrderMap[o.idNumber]; exists && resting == o {
+			live = append(live, o)
+		}
+	}
+	b.pegged = live
+
+	// Moving one pegged order can make room for (or get in the way of) another, go round until they settle
+	bid, offer := b.pegReferences()
+	for pass := 0; pass < 3; pass++ {
+		moved := false
+		for _, o := range b.pegged {
+			if price, ok := b.pegPrice(o.buyOrSell, o.peg, o.pegOffset, o.pegCap, bid, offer); ok && price != o.limit {
+				b.reprice(o, price)
+				moved = true
+			}
+		}
+		if !moved {
+			break
+		}
+	}
+	b.pegPrices = b.pegState()
+}
+
+// pegState returns what pegged orders are priced off: the unpegged best bid and offer, and the actual best bid and offer
+func (b *Book) pegState() [4]int {
+	bid, offer := b.pegReferences()
+	state := [4]int{bid, offer, 0, 0}
+	if best := b.bestBid(); best != nil {
+		state[2] = best.LimitPrice
+	}
+	if best := b.bestOffer(); best != nil {
+		state[3] = best.LimitPrice
+	}
+	return state
+}
+
+// reprice moves resting order o to price, at the back of the queue there
+func (b *Book) reprice(o *Order, price int) {
+	b.Cancel(o.idNumber)
+	o.limit = price
+	o.entryTime = time.Now().Unix()
+	b.place(o)
+}
@@ -0,0 +1,50 @@
+package book
+
+import "testing"
+
+// Pegged orders rest at their peg, follow it as the unpegged best bid and offer move, and never cross the spread
+func TestPeg(t *testing.T) {
+	b := startBook(nil)
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 5, Peg: PegBid}); r.Status != StatusRejected {
+		t.Errorf("order pegged to an empty book %s, want rejected", r.Status)
+	}
+
+	send(b, &OrderSchema{UserID: 3, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 46})
+	offer := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52}
+	send(b, offer)
+	mid := &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 5, Peg: PegMid}
+	capped := &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 5, Peg: PegBid, PegOffset: 1, PegCap: 48}
+	aggressive := &OrderSchema{UserID: 6, Side: "buy", OrderType: "limit", Qty: 5, Peg: PegBid, PegOffset: 10}
+	for _, o := range []*OrderSchema{mid, capped, aggressive} {
+		if r := send(b, o); r.Status != StatusNew {
+			t.Errorf("pegged order %s, want new", r.Status)
+		}
+	}
+	price := func(o *OrderSchema) int {
+		s, _ := b.GetOrder(o.OrderID, o.UserID)
+		return s.LimitPrice
+	}
+	check := func(when string, want ...int) {
+		t.Helper()
+		for i, o := range []*OrderSchema{mid, capped, aggressive} {
+			if p := price(o); p != want[i] {
+				t.Errorf("%s: %s peg (offset %d) at %d, want %d", when, o.Peg, o.PegOffset, p, want[i])
+			}
+		}
+	}
+	check("placed", 49, 47, 51)
+
+	// A better unpegged bid moves them, except past the cap
+	send(b, &OrderSchema{UserID: 3, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 48})
+	check("bid raised", 50, 48, 51)
+
+	// With no offer there's no mid, so that one stays put
+	cancelOrder(b, offer.OrderID, 2)
+	check("offer gone", 50, 48, 58)
+
+	// A pegged order is matched like any other resting order
+	r := send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "market", Qty: 5})
+	if len(r.Fills) != 1 || r.Fills[0].CounterParty != aggressive.OrderID || r.Fills[0].Price != 58 {
+		t.Errorf("got fills %+v, want 5 from the pegged order at 58", r.Fills)
+	}
+}
@@ -0,0 +1,57 @@
+package book
+
+import "math"
+
+// Market orders sweep the book until they're filled or it runs out, unless they're protected.  A market order (or a
+// stop, once it triggers) can name a ProtectionPrice, the worst price it will trade at, and/or a MaxSlippage, the most
+// it will trade away from the best price on the other side of the book when it starts matching, in percent.  If it
+// has both, whichever is tighter wins.  It stops sweeping there, like a limit order stops at its limit.  In an auction
+// there's no best price to slip from, so MaxSlippage is ignored, and a market order with a ProtectionPrice joins as a
+// limit order at that price.
+//
+// A market to limit order sweeps like a market order, but whatever it can't fill rests on the book as a limit order at
+// the last price it traded at, instead of being cancelled.  If it doesn't trade at all, there's no price to rest at and
+// it's cancelled.  In an auction it's held like a market order until the uncross, and rests at the clearing price.
+
+// protectionLimit returns the worst price market order o will trade at, or noLimit if it isn't protected
+func (b *Book) protectionLimit(o *OrderSchema) int {
+	buyOrSell := o.Side == "buy"
+	limitPrice := noLimit
+	if o.ProtectionPrice > 0 {
+		limitPrice = o.ProtectionPrice
+	}
+	if o.MaxSlippage > 0 {
+		slippage := b.slippageLimit(buyOrSell, o.MaxSlippage)
+		if limitPrice == noLimit || (buyOrSell && slippage < limitPrice) || (!buyOrSell && slippage > limitPrice) {
+			limitPrice = slippage
+		}
+	}
+	return limitPrice
+}
+
+// slippageLimit returns the worst price an incoming buy (or sell) can trade at without slipping more than percent
+// from the best price on the other side of the book
+func (b *Book) slippageLimit(buyOrSell bool, percent float64) int {
+	if buyOrSell {
+		best := b.bestOffer()
+		if best == nil {
+			return noLimit
+		}
+		return int(math.Floor(float64(best.LimitPrice) * (1 + percent/100)))
+	}
+	best := b.bestBid()
+	if best == nil {
+		return noLimit
+	}
+	return int(math.Ceil(float64(best.LimitPrice) * (1 - percent/100)))
+}
+
+// marketToLimit turns market to limit order o, with fills in r, into a limit order at its last fill price.  Does
+// nothing to any other order, or if nothing filled
+func marketToLimit(o *OrderSchema, r *ExecutionReport) {
+	if o.OrderType != "market_to_limit" || len(r.Fills) == 0 {
+		return
+	}
+	o.OrderType = "limit"
+	o.LimitPrice = r.Fills[len(r.Fills)-1].Price
+}
@@ -0,0 +1,46 @@
+package book
+
+import "testing"
+
+// Protected market orders stop at the tighter of their protection price and slippage cap, market to limit orders rest
+// what they can't fill at their last fill price
+func TestProtection(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   OrderSchema
+		filled  int
+		resting int // Shares left on the book at limit
+		limit   int
+	}{
+		{"unprotected", OrderSchema{OrderType: "market", Qty: 20}, 15, 0, 0},
+		{"protection price", OrderSchema{OrderType: "market", Qty: 20, ProtectionPrice: 100}, 5, 0, 0},
+		{"slippage", OrderSchema{OrderType: "market", Qty: 20, MaxSlippage: 5}, 10, 0, 0},
+		{"tighter of the two", OrderSchema{OrderType: "market", Qty: 20, ProtectionPrice: 110, MaxSlippage: 5}, 10, 0, 0},
+		{"market to limit", OrderSchema{OrderType: "market_to_limit", Qty: 20}, 15, 5, 110},
+		{"protected market to limit", OrderSchema{OrderType: "market_to_limit", Qty: 20, MaxSlippage: 5}, 10, 10, 104},
+	}
+	for _, tt := range tests {
+		b := startBook(nil)
+		for _, price := range []int{100, 104, 110} {
+			send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: price})
+		}
+
+		o := tt.order
+		o.UserID, o.Side = 4, "buy"
+		r := send(b, &o)
+		if r.FilledQty != tt.filled || r.RemainingQty != tt.resting {
+			t.Errorf("%s: filled %d with %d resting, want %d with %d resting", tt.name, r.FilledQty, r.RemainingQty, tt.filled, tt.resting)
+		}
+		if tt.resting > 0 {
+			if s, _ := b.GetOrder(o.OrderID, 4); s.LimitPrice != tt.limit {
+				t.Errorf("%s: rests at %d, want %d", tt.name, s.LimitPrice, tt.limit)
+			}
+		}
+	}
+
+	// With nothing to trade, a market to limit order has no price to rest at
+	b := startBook(nil)
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market_to_limit", Qty: 5}); r.Status != StatusCancelled || r.RemainingQty != 0 {
+		t.Errorf("market to limit order on an empty book %s with %d resting, want cancelled", r.Status, r.RemainingQty)
+	}
+}
@@ -0,0 +1,65 @@
+package book
+
+import "time"
+
+// A Quote is what a market order would get from the book right now, without sending one: it walks the other side of
+// the book from the best price, the way sweep would, and adds up the fills.  The book works it out on its matching
+// goroutine between orders, so it's priced off a consistent book, never one half way through a match.
+//
+// Quotes only count displayed shares (no iceberg reserves or hidden orders, which would give them away), leave out
+// resting orders whose minimum the order couldn't fill, and stop at the price bands, like a real order would.  They
+// don't know about self trade prevention or the ledger.
+
+// Quote is an estimate of how a market order for Qty shares would fill
+type Quote struct {
+	Side       string  `json:"side"`
+	Qty        int     `json:"qty"`
+	FilledQty  int     `json:"filled_qty"`           // Shares the book has for the order
+	AvgPrice   float64 `json:"avg_price"`            // Average price of those shares, 0 if there aren't any
+	WorstPrice int     `json:"worst_price"`          // Price of the last of them, 0 if there aren't any
+	TotalCost  int     `json:"total_cost"`           // What they cost altogether
+	Sufficient bool    `json:"sufficient_liquidity"` // Whether the book has all Qty shares
+	State      string  `json:"state"`                // The book's state; outside continuous trading nothing matches right away
+}
+
+// Quote returns how a market buy (or sell) for qty shares would fill right now.  Returns nil if the book doesn't get
+// to it within timeout
+func (b *Book) Quote(buyOrSell bool, qty int, timeout time.Duration) *Quote {
+	reply := make(chan *Quote, 1)
+	expired := time.After(timeout)
+	select {
+	case b.controls <- func() { reply <- b.quote(buyOrSell, qty) }:
+	case <-expired:
+		return nil
+	}
+	select {
+	case q := <-reply:
+		return q
+	case <-expired:
+		return nil
+	}
+}
+
+// quote works out a Quote, on the matching goroutine
+func (b *Book) quote(buyOrSell bool, qty int) *Quote {
+	q := new(Quote)
+	q.Side = "sell"
+	if buyOrSell {
+		q.Side = "buy"
+	}
+	q.Qty = qty
+	q.State = b.state
+
+	// Nobody's order, so no self trade prevention
+	t := taker{0, 0, buyOrSell, "", 0}
+	q.FilledQty = b.simulate(t, b.bandLimit(buyOrSell, noLimit), qty, true, func(price int, fillQty int) {
+		q.TotalCost += fillQty * price
+		q.WorstPrice = price
+	})
+
+	if q.FilledQty > 0 {
+		q.AvgPrice = float64(q.TotalCost) / float64(q.FilledQty)
+	}
+	q.Sufficient = q.FilledQty == qty
+	return q
+}
@@ -0,0 +1,25 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// Quotes only count displayed shares, so they can't be used to find hidden orders or iceberg reserves
+func TestQuoteDisplayedOnly(t *testing.T) {
+	b := startBook(nil)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50, Hidden: true})
+	if q := b.Quote(true, 5, time.Second); q.FilledQty != 0 || q.Sufficient {
+		t.Errorf("hidden order quoted: %+v", q)
+	}
+
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 20, LimitPrice: 51, DisplayQty: 5})
+	send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52})
+	q := b.Quote(true, 30, time.Second)
+	if q.FilledQty != 10 || q.TotalCost != 5*51+5*52 || q.WorstPrice != 52 || q.Sufficient {
+		t.Errorf("got %+v, want 5 at 51 and 5 at 52", q)
+	}
+	if q := b.Quote(false, 1, time.Second); q.FilledQty != 0 || q.AvgPrice != 0 {
+		t.Errorf("quoted a sell with no bids: %+v", q)
+	}
+}
@@ -0,0 +1,141 @@
+package book
+
+import "fmt"
+
+// Whenever a book is done with an order off the OrderQueue (matched it, rested it, held it for its stop price,
+// rejected it, amended or cancelled it) it sends an ExecutionReport back on the order's Reply channel, if it has one.
+// Each order is reported on exactly once; a stop is reported on when it is accepted, not when it triggers.
+
+// Order statuses reported in an ExecutionReport
+const (
+	StatusNew             = "new"              // Accepted, resting on the book (or waiting on its stop price) with nothing filled
+	StatusPartiallyFilled = "partially_filled" // Some shares filled; the rest is resting, or was cancelled
+	StatusFilled          = "filled"           // Every share filled
+	StatusCancelled       = "cancelled"        // Cancelled with nothing filled; killed FOKs and unfilled IOC/market orders too
+	StatusRejected        = "rejected"         // Never accepted, see Reason
+	StatusNotFound        = "not_found"        // No order with that ID belongs to the user
+)
+
+// Fill is a single trade against a resting order
+type Fill struct {
+	Price        int `json:"price"`
+	Qty          int `json:"qty"`
+	CounterParty int `json:"counterparty_order_id"` // ID of the resting order it traded with
+}
+
+// ExecutionReport is what a book reports back about an order on OrderSchema.Reply
+type ExecutionReport struct {
+	OrderID      int     `json:"order_id"`
+	Status       string  `json:"status"`
+	Reason       string  `json:"reason,omitempty"` // Why the order was rejected
+	Fills        []Fill  `json:"fills"`
+	FilledQty    int     `json:"filled_qty"`             // Shares in Fills
+	AvgPrice     float64 `json:"avg_price"`              // Average price of the fills, 0 if nothing filled
+	CumQty       int     `json:"cum_qty"`                // Shares the order has filled altogether, including before an amend or cancel
+	RemainingQty int     `json:"remaining_qty"`          // Shares still open on the book
+	UnspentCash  int     `json:"unspent_cash,omitempty"` // Cash a notional buy didn't spend
+
+	ClientOrderID string `json:"client_order_id,omitempty"` // The client order ID of the order (see client.go), if it has one
+
+	SelfTrades []SelfTrade `json:"self_trades_prevented,omitempty"`
+}
+
+// newReport returns a blank report for the order with orderID
+func newReport(orderID int) *ExecutionReport {
+	r := new(ExecutionReport)
+	r.OrderID = orderID
+	r.Fills = make([]Fill, 0)
+	return r
+}
+
+// rejection returns a report rejecting order o for reason
+func rejection(o *OrderSchema, reason string) *ExecutionReport {
+	r := newReport(o.OrderID)
+	r.Status = StatusRejected
+	r.Reason = reason
+	return r
+}
+
+// addFills records fills in the report, keeping FilledQty and AvgPrice up to date
+func (r *ExecutionReport) addFills(fills []Fill) {
+	r.Fills = append(r.Fills, fills...)
+	r.FilledQty = 0
+	cost := 0
+	for _, f := range r.Fills {
+		r.FilledQty += f.Qty
+		cost += f.Qty * f.Price
+	}
+	if r.FilledQty > 0 {
+		r.AvgPrice = float64(cost) / float64(r.FilledQty)
+	}
+}
+
+// TotalCost returns what the report's fills cost altogether
+func (r *ExecutionReport) TotalCost() int {
+	cost := 0
+	for _, f := range r.Fills {
+		cost += f.Qty * f.Price
+	}
+	return cost
+}
+
+// settle sets the report's status from an order for qty shares, given what filled and how many shares rest on the book.
+// CumQty is set beforehand if the order filled shares before this report's fills
+func (r *ExecutionReport) settle(qty int, remaining int) {
+	r.RemainingQty = remaining
+	if r.CumQty < r.FilledQty {
+		r.CumQty = r.FilledQty
+	}
+	switch {
+	case r.CumQty >= qty:
+		r.Status = StatusFilled
+	case r.CumQty > 0:
+		r.Status = StatusPartiallyFilled
+	case remaining > 0:
+		r.Status = StatusNew
+	default:
+		r.Status = StatusCancelled
+	}
+}
+
+// settleNotional sets the report's status from a notional buy of cash.  It's filled if what's left wouldn't buy
+// another share at the last price it paid
+func (r *ExecutionReport) settleNotional(cash int) {
+	r.UnspentCash = cash - r.TotalCost()
+	r.RemainingQty = 0
+	r.CumQty = r.FilledQty
+	switch {
+	case r.FilledQty == 0:
+		r.Status = StatusCancelled
+	case r.UnspentCash < r.Fills[len(r.Fills)-1].Price:
+		r.Status = StatusFilled
+	default:
+		r.Status = StatusPartiallyFilled
+	}
+}
+
+// report sends r back to whoever is waiting on o, at most once
+func (o *OrderSchema) report(r *ExecutionReport) {
+	if o.reported {
+		return
+	}
+	o.reported = true
+	if r.Status == StatusRejected && o.Action == ActionNew {
+		// Nothing was placed, there's nothing to find by its ID
+		orderBooks.Delete(o.OrderID)
+	}
+	if o.ClientOrderID != "" {
+		r.ClientOrderID = o.ClientOrderID
+	}
+	o.acknowledge(r)
+	if o.Reply != nil {
+		o.Reply <- r
+	}
+}
+
+func (r *ExecutionReport) String() string {
+	if r.Status == StatusRejected {
+		return fmt.Sprintf("Order %d rejected: %s", r.OrderID, r.Reason)
+	}
+	return fmt.Sprintf("Order %d %s: filled %d shares at avg %.2f, %d still open", r.OrderID, r.Status, r.FilledQty, r.AvgPrice, r.RemainingQty)
+}
@@ -0,0 +1,91 @@
+package book
+
+import (
+	"fmt"
+
+	"exchange/users"
+)
+
+// Self trade prevention stops a user's incoming order from matching against their own resting order, so the ledger
+// never records a wash trade.  What happens instead depends on the incoming order's mode: OrderSchema.SelfTradePrevention
+// if it has one, otherwise the mode set on the user's account, otherwise cancel newest.
+// Every time it happens, a SelfTrade event is added to the incoming order's execution report.
+
+// Self trade prevention modes
+const (
+	STPCancelNewest       = "cancel_newest"        // Cancel whatever is left of the incoming order (default)
+	STPCancelOldest       = "cancel_oldest"        // Cancel the resting order, keep matching the incoming one
+	STPCancelBoth         = "cancel_both"          // Cancel both
+	STPDecrementAndCancel = "decrement_and_cancel" // Take the smaller order's size off both; the smaller is cancelled, the larger carries on
+)
+
+// ValidSelfTradePrevention reports whether mode is one of the self trade prevention modes
+func ValidSelfTradePrevention(mode string) bool {
+	switch mode {
+	case STPCancelNewest, STPCancelOldest, STPCancelBoth, STPDecrementAndCancel:
+		return true
+	}
+	return false
+}
+
+// SelfTrade is the event emitted when self trade prevention stops an order from trading with one of its owner's resting orders
+type SelfTrade struct {
+	Mode         string `json:"mode"`
+	TakerOrderID int    `json:"taker_order_id"`
+	MakerOrderID int    `json:"maker_order_id"`
+	Qty          int    `json:"qty"` // Shares that would have traded
+}
+
+// taker describes the incoming side of a sweep
+type taker struct {
+	orderID   int
+	userID    int
+	buyOrSell bool
+	stp       string // Self trade prevention mode
+	cash      int    // Most a notional buy can spend, 0 if it's for a number of shares (see notional.go)
+}
+
+// selfTradeMode returns the self trade prevention mode for an order with mode from userID: the order's own if it has
+// one, otherwise the account's, otherwise cancel newest
+func selfTradeMode(mode string, userID int) string {
+	if mode != "" {
+		return mode
+	}
+	if u := users.GetLedger().GetUser(userID); u != nil {
+		if mode := u.GetSelfTradePrevention(); mode != "" {
+			return mode
+		}
+	}
+	return STPCancelNewest
+}
+
+// preventSelfTrade stops t, with remaining shares left, from trading with resting, one of its owner's own orders,
+// according to t's mode, and records the event in r.
+// Returns how many of the taker's shares were decremented away, and whether the taker should stop matching altogether
+func (b *Book) preventSelfTrade(t taker, resting *Order, remaining int, r *ExecutionReport) (int, bool) {
+	open := resting.shares + resting.reserve
+	qty := remaining
+	if open < qty {
+		qty = open
+	}
+	r.SelfTrades = append(r.SelfTrades, SelfTrade{t.stp, t.orderID, resting.idNumber, qty})
+	fmt.Printf("Self trade prevented (%s) between orders %d and %d of user %d\n", t.stp, t.orderID, resting.idNumber, t.userID)
+
+	switch t.stp {
+	case STPCancelOldest:
+		b.Cancel(resting.idNumber)
+		return 0, false
+	case STPCancelBoth:
+		b.Cancel(resting.idNumber)
+		return 0, true
+	case STPDecrementAndCancel:
+		if qty == open {
+			b.Cancel(resting.idNumber)
+		} else {
+			b.shrink(resting, open-qty)
+		}
+		return qty, false
+	}
+	// Cancel newest
+	return 0, true
+}
@@ -0,0 +1,55 @@
+package book
+
+import "testing"
+
+// Each self trade prevention mode, for a market buy of 8 that meets 5 of its owner's shares at 50 before 5 of someone
+// else's at 51
+func TestSelfTradePrevention(t *testing.T) {
+	tests := []struct {
+		mode    string
+		filled  int // Shares bought at 51
+		resting int // Owner's shares still resting at 50
+		selfQty int // Shares the SelfTrade event says would have traded
+	}{
+		{"", 0, 5, 5},
+		{STPCancelNewest, 0, 5, 5},
+		{STPCancelOldest, 5, 0, 5},
+		{STPCancelBoth, 0, 0, 5},
+		{STPDecrementAndCancel, 3, 0, 5},
+	}
+	for _, test := range tests {
+		b := startBook(nil)
+		own := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+		send(b, own)
+		send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 51})
+
+		o := &OrderSchema{UserID: 2, Side: "buy", OrderType: "market", Qty: 8, SelfTradePrevention: test.mode}
+		r := send(b, o)
+		if r.FilledQty != test.filled || (test.filled > 0 && r.Fills[0].Price != 51) {
+			t.Errorf("%q: got fills %+v, want %d at 51", test.mode, r.Fills, test.filled)
+		}
+		if v := b.GetVolumeAtLimit(50); v != test.resting {
+			t.Errorf("%q: %d of the owner's shares left resting, want %d", test.mode, v, test.resting)
+		}
+		want := SelfTrade{test.mode, o.OrderID, own.OrderID, test.selfQty}
+		if test.mode == "" {
+			want.Mode = STPCancelNewest
+		}
+		if len(r.SelfTrades) != 1 || r.SelfTrades[0] != want {
+			t.Errorf("%q: got self trades %+v, want %+v", test.mode, r.SelfTrades, want)
+		}
+	}
+}
+
+// Decrement and cancel only shrinks the resting order when it's the bigger one
+func TestSelfTradeDecrement(t *testing.T) {
+	b := startBook(nil)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 10, LimitPrice: 50})
+	r := send(b, &OrderSchema{UserID: 2, Side: "buy", OrderType: "limit", Qty: 4, LimitPrice: 50, SelfTradePrevention: STPDecrementAndCancel})
+	if r.FilledQty != 0 || r.RemainingQty != 0 {
+		t.Errorf("incoming order filled %d and left %d resting, want it decremented away", r.FilledQty, r.RemainingQty)
+	}
+	if v := b.GetVolumeAtLimit(50); v != 6 {
+		t.Errorf("resting order has %d shares, want 6", v)
+	}
+}
@@ -0,0 +1,108 @@
+package book
+
+import (
+	"fmt"
+	"time"
+)
+
+// A book is always in one of three trading states:
+//
+//	continuous: orders are matched as they arrive
+//	auction:    orders are collected and matched at the uncross (see auction.go)
+//	halted:     nothing trades.  New orders, stops and amendments are rejected, but resting orders can still be cancelled
+//
+// Transitions:
+//
+//	continuous -> auction     StartAuction, or a trade breaking through the price bands (see bands.go)
+//	auction    -> continuous  the uncross
+//	any        -> halted      Halt.  Halting during an auction stops it; its orders wait for the book to resume
+//	halted     -> auction     Resume with a reopening auction
+//	halted     -> continuous  Resume without one, after uncrossing anything the halted auction left crossed
+//
+// Every transition runs on the book's matching goroutine, between orders.
+
+// Trading states of a book
+const (
+	StateContinuous = "continuous"
+	StateAuction    = "auction"
+	StateHalted     = "halted"
+)
+
+// Reasons a book isn't trading continuously
+const (
+	ReasonCall       = "call"       // Call auction started through the API
+	ReasonVolatility = "volatility" // A trade would have broken through the price bands
+	ReasonAdmin      = "admin"      // Halted by an admin
+	ReasonReopening  = "reopening"  // Reopening auction after a halt
+)
+
+// Status is the published trading status of a book
+type Status struct {
+	State          string `json:"state"`
+	Reason         string `json:"reason,omitempty"` // Why the book isn't trading continuously
+	Note           string `json:"note,omitempty"`   // Admin's explanation of a halt
+	ReferencePrice int    `json:"reference_price"`  // Static reference price, 0 until the first trade
+	LowerBand      int    `json:"lower_band"`       // Lowest price a trade can happen at right now, 0 if unbounded
+	UpperBand      int    `json:"upper_band"`       // Highest price a trade can happen at right now, 0 if unbounded
+}
+
+// GetState returns the book's trading state
+func (b *Book) GetState() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.state
+}
+
+// GetStatus returns the book's trading status and the prices it can trade between
+func (b *Book) GetStatus() Status {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	lo, hi := b.bands()
+	return Status{b.state, b.stateReason, b.haltNote, b.staticRef, lo, hi}
+}
+
+// Halt stops all trading in the book until Resume.  note says why, e.g. news pending
+func (b *Book) Halt(note string) {
+	b.controls <- func() { b.halt(note) }
+}
+
+// Resume ends a halt.  A reopening auction of auctionDuration is run first, unless auctionDuration is 0
+func (b *Book) Resume(auctionDuration time.Duration) {
+	b.controls <- func() { b.resume(auctionDuration) }
+}
+
+func (b *Book) halt(note string) {
+	if b.auctionTimer != nil {
+		// The auction's orders stay where they are until the book resumes
+		b.auctionTimer.Stop()
+		b.auctionTimer = nil
+	}
+	b.auctionInfo = nil
+	b.state = StateHalted
+	b.stateReason = ReasonAdmin
+	b.haltNote = note
+	fmt.Printf("Trading halted: %s\n", note)
+}
+
+func (b *Book) resume(auctionDuration time.Duration) {
+	if b.state != StateHalted {
+		return
+	}
+	b.haltNote = ""
+	if auctionDuration > 0 {
+		b.startAuction(auctionDuration)
+		b.stateReason = ReasonReopening
+		return
+	}
+	// An auction the halt interrupted may have left the book crossed, or market orders waiting
+	b.uncross()
+}
+
+// rejectHalted reports whether o has to be turned away because the book is halted, and if so rejects it
+func (b *Book) rejectHalted(o *OrderSchema) bool {
+	if b.state != StateHalted || o.Action == ActionCancel {
+		return false
+	}
+	o.report(rejection(o, "trading is halted"))
+	return true
+}
@@ -0,0 +1,70 @@
+package book
+
+import (
+	"testing"
+	"time"
+)
+
+// A halted book rejects new orders and amendments but still takes cancels, and trades again once it resumes
+func TestHalt(t *testing.T) {
+	b := startBook(nil)
+	resting := &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50}
+	send(b, resting)
+	other := &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 51}
+	send(b, other)
+
+	b.Halt("news pending")
+	flush(b)
+	if s := b.GetStatus(); s.State != StateHalted || s.Reason != ReasonAdmin || s.Note != "news pending" {
+		t.Errorf("status %+v, want halted by an admin for news pending", s)
+	}
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 5}); r.Status != StatusRejected || r.Reason != "trading is halted" {
+		t.Errorf("new order %s (%s) while halted", r.Status, r.Reason)
+	}
+	if r := amend(b, resting.OrderID, OrderSchema{UserID: 2, Qty: 2}); r.Status != StatusRejected {
+		t.Errorf("amendment %s while halted", r.Status)
+	}
+	if r := cancelOrder(b, other.OrderID, 3); r.Status != StatusCancelled {
+		t.Errorf("cancel %s while halted", r.Status)
+	}
+
+	b.Resume(0)
+	flush(b)
+	if s := b.GetStatus(); s.State != StateContinuous || s.Note != "" {
+		t.Errorf("status %+v after resuming, want continuous", s)
+	}
+	if r := send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 10}); r.FilledQty != 5 || r.AvgPrice != 50 {
+		t.Errorf("filled %d at %.2f after resuming, want the 5 at 50 that weren't cancelled", r.FilledQty, r.AvgPrice)
+	}
+}
+
+// Resuming runs a reopening auction if asked to, and otherwise uncrosses whatever an auction the halt stopped left
+func TestResume(t *testing.T) {
+	b := startBook(nil)
+	b.StartAuction(time.Hour)
+	flush(b)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50})
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 51})
+	b.Halt("")
+	b.Resume(0)
+	flush(b)
+	if p := position(b, 4); p != 5 || b.GetState() != StateContinuous {
+		t.Errorf("bought %d shares and %s after resuming, want the crossed orders uncrossed", p, b.GetState())
+	}
+
+	b.Halt("")
+	b.Resume(20 * time.Millisecond)
+	flush(b)
+	if s := b.GetStatus(); s.State != StateAuction || s.Reason != ReasonReopening {
+		t.Errorf("status %+v, want a reopening auction", s)
+	}
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 50})
+	send(b, &OrderSchema{UserID: 4, Side: "buy", OrderType: "market", Qty: 5})
+	if p := position(b, 4); p != 5 {
+		t.Errorf("position %d during the reopening auction, want nothing traded yet", p)
+	}
+	waitFor(t, "the reopening uncross", func() bool { return b.GetState() == StateContinuous })
+	if p := position(b, 4); p != 10 {
+		t.Errorf("position %d after the reopening auction, want 10", p)
+	}
+}
@@ -0,0 +1,164 @@
+package book
+
+import (
+	"math"
+
+	"github.com/HuKeping/rbtree"
+)
+
+// Stop and stop-limit orders don't rest in the limit trees.  They wait in one of two trigger trees keyed off stop price:
+// 	buyStops  release when the market price rises to or through their stop price
+// 	sellStops release when the market price falls to or through their stop price
+//
+// Once released, a stop becomes a market order and a stop-limit becomes a limit order at OrderSchema.LimitPrice,
+// and they are matched before the next order is taken off the OrderQueue.
+// When one trade moves through several stops they are released one at a time, the stop price closest to where the
+// price came from first (lowest buy stop, highest sell stop), and in arrival order within a stop price.
+// The next stop isn't picked until the previous one is matched, so stops triggered by that match are released in order too.
+
+// stopLevel holds the stop orders waiting at a stop price, oldest first
+type stopLevel struct {
+	StopPrice int
+	orders    []*OrderSchema
+}
+
+// Order RB-Tree by stop price
+func (x *stopLevel) Less(than rbtree.Item) bool {
+	return x.StopPrice < than.(*stopLevel).StopPrice
+}
+
+// isStop reports whether the order waits for a stop price before it is matched
+func (o *OrderSchema) isStop() bool {
+	return o.OrderType == "stop" || o.OrderType == "stop_limit"
+}
+
+// addStop holds stop order o in the trigger tree for its side until the market price reaches its stop price
+func (b *Book) addStop(o *OrderSchema) {
+	tree := b.sellStops
+	if o.Side == "buy" {
+		tree = b.buyStops
+	}
+
+	key := &stopLevel{StopPrice: o.StopPrice}
+	if existing := tree.Get(key); existing != nil {
+		l := existing.(*stopLevel)
+		l.orders = append(l.orders, o)
+		return
+	}
+	key.orders = []*OrderSchema{o}
+	tree.Insert(key)
+}
+
+// heldStop is the report for stop order o being accepted and held until its stop price
+func (b *Book) heldStop(o *OrderSchema) *ExecutionReport {
+	r := newReport(o.OrderID)
+	r.settle(o.Qty, o.Qty)
+	return r
+}
+
+// nextTriggeredStop removes and returns the next stop the market price has reached, converted to the order it becomes
+// when released.  Returns nil if no stop has been triggered
+func (b *Book) nextTriggeredStop() *OrderSchema {
+	// No trades yet, nothing to trigger off of
+	if b.marketPrice == 0 {
+		return nil
+	}
+
+	var l *stopLevel
+	var tree *rbtree.Rbtree
+	if min := b.buyStops.Min(); min != nil && min.(*stopLevel).StopPrice <= b.marketPrice {
+		l, tree = min.(*stopLevel), b.buyStops
+	} else if max := b.sellStops.Max(); max != nil && max.(*stopLevel).StopPrice >= b.marketPrice {
+		l, tree = max.(*stopLevel), b.sellStops
+	} else {
+		return nil
+	}
+
+	o := l.orders[0]
+	l.orders = l.orders[1:]
+	if len(l.orders) == 0 {
+		tree.Delete(l)
+	}
+
+	if o.OrderType == "stop" {
+		o.OrderType = "market"
+	} else {
+		o.OrderType = "limit"
+	}
+	return o
+}
+
+// Trailing stops don't have a fixed stop price, so they wait in Book.trailingStops (arrival order) instead.
+// Each time the market price moves, a trailing stop remembers the best price since it was entered (the highest for a sell,
+// the lowest for a buy) and keeps its stop price a fixed amount or percentage away from it.  Once the market reverses
+// through that stop price it becomes a regular stop (or stop-limit) at that price, and is released like any other stop.
+
+// isTrailingStop reports whether the order's stop price trails the market
+func (o *OrderSchema) isTrailingStop() bool {
+	return o.OrderType == "trailing_stop" || o.OrderType == "trailing_stop_limit"
+}
+
+// trail moves trailing stop o along with the market price, returning true if price has reversed through the stop.
+// A triggered trailing stop is converted to the stop or stop_limit order it becomes
+func (b *Book) trail(o *OrderSchema, price int) bool {
+	buy := o.Side == "buy"
+	if o.trailRef == 0 || (buy && price < o.trailRef) || (!buy && price > o.trailRef) {
+		o.trailRef = price
+	}
+
+	distance := o.TrailAmount
+	if o.TrailPercent > 0 {
+		// Rounded up to whole ticks, and never less than one, or the stop would sit on the price it trails and trigger
+		// straight away
+		ticks := int(math.Ceil(float64(o.trailRef) * o.TrailPercent / 100 / float64(b.tickSize)))
+		if ticks < 1 {
+			ticks = 1
+		}
+		distance = ticks * b.tickSize
+	}
+
+	// Keep the stop on the tick grid, rounding away from the market
+	if buy {
+		o.StopPrice = b.onTick(false, o.trailRef+distance)
+		if price < o.StopPrice {
+			return false
+		}
+	} else {
+		o.StopPrice = b.onTick(true, o.trailRef-distance)
+		if price > o.StopPrice {
+			return false
+		}
+	}
+
+	if o.OrderType == "trailing_stop" {
+		o.OrderType = "stop"
+	} else {
+		// Limit is set off the stop price the order triggered at
+		o.OrderType = "stop_limit"
+		if buy {
+			o.LimitPrice = b.onTick(true, o.StopPrice+o.LimitOffset)
+		} else {
+			o.LimitPrice = b.onTick(false, o.StopPrice-o.LimitOffset)
+		}
+	}
+	return true
+}
+
+// updateTrailingStops trails every waiting trailing stop along with the current market price, moving the ones that
+// triggered into the stop trees so nextTriggeredStop releases them
+func (b *Book) updateTrailingStops() {
+	// No trades yet, nothing to trail
+	if b.marketPrice == 0 {
+		return
+	}
+
+	waiting := b.trailingStops[:0]
+	for _, o := range b.trailingStops {
+		if b.trail(o, b.marketPrice) {
+			b.addStop(o)
+		} else {
+			waiting = append(waiting, o)
+		}
+	}
+	b.trailingStops = waiting
+}
@@ -0,0 +1,117 @@
+package book
+
+import (
+	"exchange/users"
+	"testing"
+)
+
+// A trailing stop keeps at least a tick from the price it trails, however small its percentage, so it doesn't trigger
+// on the price it was entered at
+func TestTrailingStopPercent(t *testing.T) {
+	b := startBook(nil)
+	trade(b, 41)
+	send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 5, LimitPrice: 40})
+
+	stop := &OrderSchema{UserID: 4, Side: "sell", OrderType: "trailing_stop", Qty: 5, TrailPercent: 1}
+	if r := send(b, stop); r.Status != StatusNew {
+		t.Fatalf("trailing stop %s, want new", r.Status)
+	}
+	if s, _ := b.GetOrder(stop.OrderID, 4); !s.Open || s.FilledQty != 0 {
+		t.Fatalf("trailing stop triggered on entry: %+v", s)
+	}
+
+	// Trails up to 42, one tick behind at 41
+	trade(b, 42)
+	if s, _ := b.GetOrder(stop.OrderID, 4); !s.Open {
+		t.Fatalf("trailing stop triggered at 42: %+v", s)
+	}
+	trade(b, 41)
+	if s, _ := b.GetOrder(stop.OrderID, 4); s.Open || s.FilledQty != 5 {
+		t.Fatalf("trailing stop didn't trigger at 41: %+v", s)
+	}
+	if p := position(b, 5); p != 5 {
+		t.Errorf("bid at 40 holds %d shares, want 5", p)
+	}
+}
+
+// Percentage distances are rounded up to whole ticks
+func TestTrailingStopTicks(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent float64
+		price   int // Where the market goes from 100
+		trigger bool
+	}{
+		{"under a tick is one tick", 1, 95, true},
+		{"rounded up to two ticks", 7, 95, false},
+		{"two ticks reached", 7, 90, true},
+	}
+	for _, tt := range tests {
+		b := startBook(nil)
+		b.SetTickSize(5)
+		flush(b)
+		trade(b, 100)
+		stop := &OrderSchema{UserID: 4, Side: "sell", OrderType: "trailing_stop", Qty: 1, TrailPercent: tt.percent}
+		send(b, stop)
+		trade(b, tt.price)
+		if s, _ := b.GetOrder(stop.OrderID, 4); s.Open == tt.trigger {
+			t.Errorf("%s: trailing stop open %v after the market went to %d", tt.name, s.Open, tt.price)
+		}
+	}
+}
+
+// Stops wait until the market reaches their stop price, then a stop matches as a market order and a stop limit as a
+// limit order
+func TestStopTrigger(t *testing.T) {
+	b := startBook(nil)
+	trade(b, 50)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 5, LimitPrice: 52})
+	send(b, &OrderSchema{UserID: 5, Side: "buy", OrderType: "limit", Qty: 2, LimitPrice: 48})
+
+	stop := &OrderSchema{UserID: 4, Side: "buy", OrderType: "stop", Qty: 3, StopPrice: 51}
+	if r := send(b, stop); r.Status != StatusNew || r.RemainingQty != 3 {
+		t.Fatalf("stop %s with %d open, want new with 3", r.Status, r.RemainingQty)
+	}
+	stopLimit := &OrderSchema{UserID: 6, Side: "sell", OrderType: "stop_limit", Qty: 4, StopPrice: 49, LimitPrice: 48}
+	send(b, stopLimit)
+	if s, _ := b.GetOrder(stop.OrderID, 4); !s.Open || s.FilledQty != 0 {
+		t.Fatalf("stop triggered before its stop price: %+v", s)
+	}
+
+	trade(b, 51)
+	if s, _ := b.GetOrder(stop.OrderID, 4); s.Open || s.Status != StatusFilled || position(b, 4) != 3 {
+		t.Errorf("stop at 51 after a trade at 51: %+v, holding %d", s, position(b, 4))
+	}
+
+	// The stop limit sells what it can at 48, and rests the rest there
+	trade(b, 49)
+	s, _ := b.GetOrder(stopLimit.OrderID, 6)
+	if !s.Open || s.FilledQty != 2 || s.RemainingQty != 2 || s.LimitPrice != 48 {
+		t.Errorf("stop limit at 49 after a trade at 49: %+v", s)
+	}
+}
+
+// Stops a trade moves through are released one at a time, the stop price nearest where the market came from first
+func TestStopOrder(t *testing.T) {
+	b := startBook(nil)
+	trade(b, 50)
+	send(b, &OrderSchema{UserID: 2, Side: "sell", OrderType: "limit", Qty: 1, LimitPrice: 53})
+	send(b, &OrderSchema{UserID: 3, Side: "sell", OrderType: "limit", Qty: 1, LimitPrice: 54})
+	send(b, &OrderSchema{UserID: 9, Side: "sell", OrderType: "limit", Qty: 2, LimitPrice: 55})
+	send(b, &OrderSchema{UserID: 7, Side: "buy", OrderType: "stop", Qty: 2, StopPrice: 52})
+	send(b, &OrderSchema{UserID: 6, Side: "buy", OrderType: "stop", Qty: 1, StopPrice: 51})
+
+	send(b, &OrderSchema{UserID: 8, Side: "buy", OrderType: "market", Qty: 1})
+	// The stop at 51 takes the share at 54, leaving the one at 52 both shares at 55
+	history := users.GetLedger().GetAssetHistory(b.assetID)
+	want := []struct{ price, qty int }{{53, 1}, {54, 1}, {55, 2}}
+	if len(history) < len(want) {
+		t.Fatalf("%d trades", len(history))
+	}
+	history = history[len(history)-len(want):]
+	for i, w := range want {
+		if history[i].Price != w.price || history[i].NumShares != w.qty {
+			t.Errorf("trade %d: %d at %d, want %d at %d", i, history[i].NumShares, history[i].Price, w.qty, w.price)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package book
+
+// Orders have to be priced on the asset's tick grid (see assets.Rules), which is checked before they're queued.  The
+// book also sets some prices itself: post only orders repriced behind the spread (see flags.go), pegged orders (see
+// peg.go) and trailing stops a percentage from the market (see stops.go).  Those are kept on the grid too, stepping
+// back whole ticks and rounding midpoints and percentages away from the spread.
+
+// SetTickSize sets the asset's tick size, which prices the book sets itself are multiples of.  Less than 1 means 1
+func (b *Book) SetTickSize(tickSize int) {
+	if tickSize < 1 {
+		tickSize = 1
+	}
+	b.controls <- func() { b.tickSize = tickSize }
+}
+
+// behind returns the price one tick behind price, for a buy (below it) or a sell (above it)
+func (b *Book) behind(buyOrSell bool, price int) int {
+	if buyOrSell {
+		return price - b.tickSize
+	}
+	return price + b.tickSize
+}
+
+// onTick rounds price to the tick grid, down for a buy and up for a sell, so it's never more aggressive than price
+func (b *Book) onTick(buyOrSell bool, price int) int {
+	off := price % b.tickSize
+	if off == 0 {
+		return price
+	}
+	if buyOrSell {
+		return price - off
+	}
+	return price - off + b.tickSize
+}
@@ -0,0 +1,128 @@
+package assets
+
+import (
+	"exchange/assets/book"
+	"fmt"
+)
+
+// Every asset has instrument rules, set when it's created.  Orders (and amendments) are checked against them before
+// they're queued for the asset's book, and anything that breaks one is turned away with a Violation, whose Code says
+// which rule it broke.
+
+// Rules are an asset's instrument rules
+type Rules struct {
+	TickSize      int     `json:"tick_size"`      // Prices have to be a multiple of this
+	LotSize       int     `json:"lot_size"`       // Quantities have to be a multiple of this
+	MinQty        int     `json:"min_qty"`        // Smallest order
+	MaxQty        int     `json:"max_qty"`        // Biggest order, 0 means no maximum
+	MaxNotional   int     `json:"max_notional"`   // Most an order can be worth (qty * price), 0 means no maximum
+	CollarPercent float64 `json:"collar_percent"` // How far from the market price an order's prices can be (fat finger check), 0 turns it off
+}
+
+// DefaultRules are a reasonable set of rules for a new asset
+var DefaultRules = Rules{1, 1, 1, 10000, 1000000, 50}
+
+// Violation codes, one per rule
+const (
+	ViolationTickSize    = "tick_size"
+	ViolationLotSize     = "lot_size"
+	ViolationMinQty      = "min_qty"
+	ViolationMaxQty      = "max_qty"
+	ViolationMaxNotional = "max_notional"
+	ViolationPriceCollar = "price_collar"
+)
+
+// Violation says which of its asset's rules an order breaks
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// GetRules returns the instrument rules of the asset
+func (a *Asset) GetRules() Rules {
+	return a.rules
+}
+
+// CheckOrder checks order o against the rules of its asset (o.Symbol).  Returns nil if it follows them all, or if the
+// asset doesn't exist
+func CheckOrder(o *book.OrderSchema) *Violation {
+	a := GetAssetBySymbol(o.Symbol)
+	b := GetBookBySymbol(o.Symbol)
+	if a == nil || b == nil {
+		return nil
+	}
+	return a.rules.check(o, b.GetMarketPrice())
+}
+
+// CheckAmendment checks the new qty and limit of amendment a against the rules of its asset.  A limit of 0 keeps the
+// order's price, so only its qty is checked
+func CheckAmendment(a *book.OrderSchema) *Violation {
+	o := *a
+	o.OrderType = "limit"
+	return CheckOrder(&o)
+}
+
+// check checks order o against rules r, with the asset currently trading at marketPrice (0 if it hasn't traded yet)
+func (r Rules) check(o *book.OrderSchema, marketPrice int) *Violation {
+	if o.Notional > 0 {
+		// Notional orders are for an amount of cash, they don't name a qty or a price
+		if r.MaxNotional > 0 && o.Notional > r.MaxNotional {
+			return &Violation{ViolationMaxNotional, fmt.Sprintf("Order can't be worth more than %d", r.MaxNotional)}
+		}
+		return nil
+	}
+
+	// Prices the order names; 0 means it doesn't name one
+	limitPrice, stopPrice := 0, 0
+	if o.OrderType == "limit" || o.OrderType == "stop_limit" {
+		limitPrice = o.LimitPrice
+	}
+	if o.OrderType == "stop" || o.OrderType == "stop_limit" {
+		stopPrice = o.StopPrice
+	}
+
+	if r.TickSize > 1 {
+		for _, p := range []int{limitPrice, stopPrice, o.TrailAmount, o.LimitOffset, o.PegOffset, o.PegCap, o.ProtectionPrice} {
+			if p%r.TickSize != 0 {
+				return &Violation{ViolationTickSize, fmt.Sprintf("Prices must be a multiple of the tick size, %d", r.TickSize)}
+			}
+		}
+	}
+	if r.LotSize > 1 && (o.Qty%r.LotSize != 0 || o.DisplayQty%r.LotSize != 0 || o.MinQty%r.LotSize != 0) {
+		return &Violation{ViolationLotSize, fmt.Sprintf("Quantities must be a multiple of the lot size, %d", r.LotSize)}
+	}
+	if o.Qty < r.MinQty {
+		return &Violation{ViolationMinQty, fmt.Sprintf("Quantity must be at least %d", r.MinQty)}
+	}
+	if r.MaxQty > 0 && o.Qty > r.MaxQty {
+		return &Violation{ViolationMaxQty, fmt.Sprintf("Quantity can't be more than %d", r.MaxQty)}
+	}
+
+	// Orders without a price of their own are valued at the market price
+	price := limitPrice
+	if price == 0 {
+		price = stopPrice
+	}
+	if price == 0 {
+		price = marketPrice
+	}
+	if r.MaxNotional > 0 && o.Qty*price > r.MaxNotional {
+		return &Violation{ViolationMaxNotional, fmt.Sprintf("Order can't be worth more than %d", r.MaxNotional)}
+	}
+
+	if r.CollarPercent > 0 && marketPrice > 0 {
+		for _, p := range []int{limitPrice, stopPrice} {
+			if p != 0 && float64(abs(p-marketPrice)) > float64(marketPrice)*r.CollarPercent/100 {
+				return &Violation{ViolationPriceCollar, fmt.Sprintf("Prices must be within %g%% of the market price, %d", r.CollarPercent, marketPrice)}
+			}
+		}
+	}
+	return nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
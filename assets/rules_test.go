@@ -0,0 +1,46 @@
+package assets
+
+import (
+	"exchange/assets/book"
+	"testing"
+)
+
+// Orders are checked against every rule, with orders that don't name a price valued at the market price
+func TestCheckRules(t *testing.T) {
+	rules := Rules{TickSize: 5, LotSize: 10, MinQty: 10, MaxQty: 1000, MaxNotional: 50000, CollarPercent: 10}
+	tests := []struct {
+		name  string
+		order book.OrderSchema
+		want  string // Violation code, empty if the order follows the rules
+	}{
+		{"limit on the grid", book.OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 100}, ""},
+		{"limit off the grid", book.OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 102}, ViolationTickSize},
+		{"stop off the grid", book.OrderSchema{OrderType: "stop", Qty: 10, StopPrice: 97}, ViolationTickSize},
+		{"peg offset off the grid", book.OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 100, PegOffset: 1}, ViolationTickSize},
+		{"qty off the lot", book.OrderSchema{OrderType: "market", Qty: 15}, ViolationLotSize},
+		{"display qty off the lot", book.OrderSchema{OrderType: "limit", Qty: 20, LimitPrice: 100, DisplayQty: 5}, ViolationLotSize},
+		{"too small", book.OrderSchema{OrderType: "market", Qty: 0}, ViolationMinQty},
+		{"too big", book.OrderSchema{OrderType: "market", Qty: 1010}, ViolationMaxQty},
+		{"market worth too much", book.OrderSchema{OrderType: "market", Qty: 510}, ViolationMaxNotional},
+		{"market worth just enough", book.OrderSchema{OrderType: "market", Qty: 500}, ""},
+		{"limit worth too much", book.OrderSchema{OrderType: "limit", Qty: 500, LimitPrice: 105}, ViolationMaxNotional},
+		{"notional over the max", book.OrderSchema{OrderType: "market", Notional: 50001}, ViolationMaxNotional},
+		{"notional has no qty", book.OrderSchema{OrderType: "market", Notional: 500}, ""},
+		{"limit outside the collar", book.OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 115}, ViolationPriceCollar},
+		{"stop on the collar", book.OrderSchema{OrderType: "stop", Qty: 10, StopPrice: 90}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if v := rules.check(&tt.order, 100); v != nil {
+			got = v.Code
+		}
+		if got != tt.want {
+			t.Errorf("%s: got violation %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Before the first trade there's no market price to value orders at, or to collar them around
+	if v := rules.check(&book.OrderSchema{OrderType: "limit", Qty: 10, LimitPrice: 500}, 0); v != nil {
+		t.Errorf("collared with no market price: %+v", v)
+	}
+}
@@ -3,16 +3,18 @@ package main
 import (
 	"exchange/api"
 	"exchange/assets"
+	"exchange/assets/book"
 	"exchange/users"
 )
 
 func main() {
 	// Initialize empty maps for books and assets
 	assets.Initialize()
-	assets.CreateAsset("Travis Scott", "TRAV")
-	assets.CreateAsset("24kGolden", "24k")
-	assets.CreateAsset("Parallel Doug", "DOUG")
-	assets.CreateAsset("Parallel Art", "ART")
+	assets.CreateAsset("Travis Scott", "TRAV", book.FIFO{}, assets.DefaultRules, book.DefaultPriceBands)
+	assets.CreateAsset("24kGolden", "24k", book.FIFO{}, assets.DefaultRules, book.DefaultPriceBands)
+	// Thinner card assets share fills at each price to reward resting size
+	assets.CreateAsset("Parallel Doug", "DOUG", book.ProRata{}, assets.DefaultRules, book.DefaultPriceBands)
+	assets.CreateAsset("Parallel Art", "ART", book.TopOrderProRata{}, assets.DefaultRules, book.DefaultPriceBands)
 
 	travBook := assets.GetBookByID(1)
 	travBook.InOrderTraversal()
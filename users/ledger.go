@@ -2,6 +2,7 @@ package users
 
 import (
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -21,11 +22,15 @@ type Transaction struct {
 // Ledger holds all transactions ever made.
 type Ledger struct {
 	historyAll       []*Transaction
-	HistoryByAssetID map[int][]*Transaction
+	HistoryByAssetID map[int][]*Transaction // Read it through GetAssetHistory, which holds mu
 	historyByUserID  map[int][]*Transaction
 
 	// pointer to all Users held here so as to access it
 	users *Users
+
+	// Every asset's book records its trades here from its own goroutine, while the API reads users and histories from
+	// others.  Held for writing by RecordTrade, for reading by the accessors
+	mu sync.RWMutex
 }
 
 // GlobalLedger is the ledger keeping track of all transactions.  Constructed in users.Initialize()
@@ -59,17 +64,47 @@ func GetLedger() *Ledger {
 	return globalLedger
 }
 
-// GetAssetHistory exposes the transaction history for the asset with assetID
+// GetUser returns the user with userID, or nil if no such user exists
+func (l *Ledger) GetUser(userID int) *User {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.user(userID)
+}
+
+// user is GetUser, for callers already holding mu
+func (l *Ledger) user(userID int) *User {
+	if u, exists := l.users.users[userID]; exists {
+		return u
+	}
+	return nil
+}
+
+// GetAssetHistory exposes the transaction history for the asset with assetID, as of now
 func (l *Ledger) GetAssetHistory(assetID int) []*Transaction {
-	return l.HistoryByAssetID[assetID]
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// RecordTrade appends to it while the caller reads, so hand out a copy
+	history := make([]*Transaction, len(l.HistoryByAssetID[assetID]))
+	copy(history, l.HistoryByAssetID[assetID])
+	return history
 }
 
 // RecordTrade performs the trade operation, recording the transaction and shifting funds and ownership accordingly
 func (l *Ledger) RecordTrade(assetID int, numShares int, price int, buyerID int, sellerID int) bool {
-	buyer := l.users.users[buyerID]
-	seller := l.users.users[sellerID]
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	buyer := l.user(buyerID)
+	seller := l.user(sellerID)
 
 	// Check for errors
+	// Both counterparties must be real accounts
+	if buyer == nil || seller == nil {
+		return false
+	}
+	// Never record a wash trade
+	if buyerID == sellerID {
+		return false
+	}
 	// TODO: Implement error checking. Right now just save the transaction
 	// if buyer.cash < numShares*price {
 	// 	return false
@@ -87,7 +122,11 @@ func (l *Ledger) RecordTrade(assetID int, numShares int, price int, buyerID int,
 	t.NumShares = numShares
 	t.Price = price
 
-	// Exchange cash and numShares between users
+	// Exchange cash and numShares between users.  Only one trade is recorded at a time, so holding both users is safe
+	seller.mu.Lock()
+	defer seller.mu.Unlock()
+	buyer.mu.Lock()
+	defer buyer.mu.Unlock()
 	seller.cash += numShares * price
 	seller.sharesOwned[assetID] -= numShares
 	if seller.sharesOwned[assetID] == 0 {
@@ -96,14 +135,18 @@ func (l *Ledger) RecordTrade(assetID int, numShares int, price int, buyerID int,
 			if id == assetID {
 				seller.assets[len(seller.assets)-1], seller.assets[index] = seller.assets[index], seller.assets[len(seller.assets)-1]
 				seller.assets = seller.assets[:len(seller.assets)-1]
+				// Each asset is only listed once, and the slice just shrank under the range
+				break
 			}
 		}
 	}
 
 	buyer.cash -= numShares * price
 	buyer.sharesOwned[assetID] += numShares
-	// TODO: check if buyer already has the asset, then don't add it
-	buyer.assets = append(buyer.assets, assetID)
+	// Only list the asset if the buyer doesn't already have it
+	if !buyer.holds(assetID) {
+		buyer.assets = append(buyer.assets, assetID)
+	}
 
 	// Record transaction in Ledger
 	l.historyAll = append(l.historyAll, t)
@@ -1,5 +1,7 @@
 package users
 
+import "sync"
+
 var curUID int = 0
 
 // User is the base type representing a user; has an id, cash balance, name, array of owned assets, and a map of assetID to shares owned.
@@ -14,6 +16,13 @@ type User struct {
 	assets []int
 	// sharesOwned[assetID] = number of shares owned
 	sharesOwned map[int]int
+
+	// Self trade prevention mode for this user's orders that don't set their own ("" for the exchange default)
+	selfTradePrevention string
+
+	// Guards cash, assets, sharesOwned and selfTradePrevention, which are changed and read by every asset's book (and
+	// the API) from their own goroutines
+	mu sync.Mutex
 }
 
 // createUser returns a new user object; to be used by users.go internally
@@ -29,6 +38,8 @@ func createUser() *User {
 
 // DepositCash adds amount to u's balance
 func (u *User) DepositCash(amount int) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	if amount <= 0 {
 		return u.cash
 	}
@@ -39,6 +50,8 @@ func (u *User) DepositCash(amount int) int {
 
 // WithdrawCash removes amount from u's balance
 func (u *User) WithdrawCash(amount int) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
 	if amount <= 0 {
 		return u.cash
 	}
@@ -50,3 +63,34 @@ func (u *User) WithdrawCash(amount int) int {
 	u.cash -= amount
 	return u.cash
 }
+
+// GetSharesOwned returns how many shares of the asset with assetID u owns; negative if u is short
+func (u *User) GetSharesOwned(assetID int) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.sharesOwned[assetID]
+}
+
+// GetSelfTradePrevention returns u's default self trade prevention mode, "" if u hasn't set one
+func (u *User) GetSelfTradePrevention() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.selfTradePrevention
+}
+
+// SetSelfTradePrevention sets u's default self trade prevention mode.  The mode is checked by the caller
+func (u *User) SetSelfTradePrevention(mode string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.selfTradePrevention = mode
+}
+
+// holds reports whether assetID is in u's list of owned assets.  The caller holds u.mu
+func (u *User) holds(assetID int) bool {
+	for _, id := range u.assets {
+		if id == assetID {
+			return true
+		}
+	}
+	return false
+}